@@ -5,13 +5,16 @@ import StockSearch from '@/components/StockSearch';
 import StockPrice from '@/components/StockPrice';
 import StockChart from '@/components/StockChart';
 import { getQuote, getHistory, EnhancedQuote, DailyData, startReplay } from '@/lib/api';
-import { TrendingUp, AlertCircle, Loader2, Play, Activity } from 'lucide-react';
+import { TrendingUp, AlertCircle, Loader2, Play, Activity, ThumbsUp, ThumbsDown } from 'lucide-react';
 
 export interface Anomaly {
+    id: string;
     symbol: string;
     type: string;
-    confidence: number;
+    severity: 'info' | 'warning' | 'critical';
+    status: 'open' | 'escalated' | 'ongoing' | 'resolved';
     details: string;
+    label?: 'useful' | 'noise';
 }
 
 export default function Home() {
@@ -33,6 +36,8 @@ export default function Home() {
                 setData(msg.data);
             } else if (msg.type === 'anomaly') {
                 setAnomalies(prev => [msg.data, ...prev].slice(0, 5));
+            } else if (msg.type === 'label') {
+                setAnomalies(prev => prev.map(a => a.id === msg.data.id ? { ...a, label: msg.data.label } : a));
             }
         };
 
@@ -71,6 +76,12 @@ export default function Home() {
         }
     };
 
+    const handleLabel = (a: Anomaly, label: 'useful' | 'noise') => {
+        if (socketRef.current && socketRef.current.readyState === WebSocket.OPEN) {
+            socketRef.current.send(JSON.stringify({ action: 'label', symbol: a.symbol, id: a.id, label }));
+        }
+    };
+
     const handleReplay = async () => {
         if (!data) return;
         try {
@@ -116,7 +127,15 @@ export default function Home() {
                                 <span className="font-bold uppercase">{a.type}</span>
                                 <span className="text-muted-foreground">{a.details}</span>
                             </div>
-                            <span className="bg-primary/20 px-2 py-0.5 rounded-full font-bold">{(a.confidence * 100).toFixed(0)}%</span>
+                            <div className="flex items-center gap-2">
+                                <button onClick={() => handleLabel(a, 'useful')} title="Useful" className={a.label === 'useful' ? 'text-primary' : 'text-muted-foreground hover:text-primary'}>
+                                    <ThumbsUp className="w-3.5 h-3.5" />
+                                </button>
+                                <button onClick={() => handleLabel(a, 'noise')} title="Noise" className={a.label === 'noise' ? 'text-destructive' : 'text-muted-foreground hover:text-destructive'}>
+                                    <ThumbsDown className="w-3.5 h-3.5" />
+                                </button>
+                                <span className="bg-primary/20 px-2 py-0.5 rounded-full font-bold uppercase">{a.status === 'resolved' ? 'resolved' : a.severity}</span>
+                            </div>
                         </div>
                     ))}
                 </div>
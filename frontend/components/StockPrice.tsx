@@ -65,7 +65,7 @@ export default function StockPrice({ data }: StockPriceProps) {
                 <div className="grid grid-cols-2 gap-4 pt-4">
                     <div className="space-y-1">
                         <span className="text-muted-foreground text-[10px] font-bold uppercase tracking-widest">
-                            Volatility
+                            Volatility ({metrics.estimator})
                         </span>
                         <div className="text-lg font-bold text-foreground">
                             {metrics.Volatility.toFixed(4)}
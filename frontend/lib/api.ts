@@ -5,6 +5,7 @@ export interface RollingMetrics {
   Symbol: string;
   VWAP: number;
   Volatility: number;
+  estimator: string;
   PriceChange: number;
   VolumeChange: number;
 }
@@ -0,0 +1,209 @@
+package analytics
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Alert conditions. Crossing conditions compare the price with Value;
+// percentage conditions compare the change from the previous close.
+const (
+	AlertCrossesAbove = "crosses_above"
+	AlertCrossesBelow = "crosses_below"
+	AlertRisesPct     = "rises_pct"
+	AlertDropsPct     = "drops_pct"
+)
+
+var ErrAlertNotFound = errors.New("alert not found")
+
+// Alert is a user-defined price alert. A one-shot alert deactivates after it
+// triggers; a repeating alert re-arms once its condition stops holding.
+type Alert struct {
+	ID            string     `json:"id"`
+	User          string     `json:"user"`
+	Symbol        string     `json:"symbol"`
+	Condition     string     `json:"condition"`
+	Value         float64    `json:"value"`
+	Repeat        bool       `json:"repeat"`
+	Active        bool       `json:"active"`
+	CreatedAt     time.Time  `json:"created_at"`
+	LastTriggered *time.Time `json:"last_triggered,omitempty"`
+}
+
+type AlertTrigger struct {
+	Alert     Alert     `json:"alert"`
+	Price     float64   `json:"price"`
+	ChangePct float64   `json:"change_pct"`
+	Message   string    `json:"message"`
+	Time      time.Time `json:"time"`
+}
+
+type AlertEngine struct {
+	alerts map[string]*alertState
+	mu     sync.Mutex
+}
+
+type alertState struct {
+	Alert
+	seen  bool // whether the condition has been evaluated yet
+	armed bool
+}
+
+func NewAlertEngine() *AlertEngine {
+	return &AlertEngine{alerts: make(map[string]*alertState)}
+}
+
+// Set validates and stores an alert, assigning an ID to new ones.
+func (ae *AlertEngine) Set(a Alert) (Alert, error) {
+	a.Symbol = strings.ToUpper(strings.TrimSpace(a.Symbol))
+	a.User = strings.TrimSpace(a.User)
+	if a.User == "" || a.Symbol == "" {
+		return a, fmt.Errorf("an alert needs a user and a symbol")
+	}
+	switch a.Condition {
+	case AlertCrossesAbove, AlertCrossesBelow:
+		if a.Value <= 0 {
+			return a, fmt.Errorf("price level must be positive")
+		}
+	case AlertRisesPct, AlertDropsPct:
+		if a.Value <= 0 || a.Value >= 100 {
+			return a, fmt.Errorf("percentage must be between 0 and 100")
+		}
+	default:
+		return a, fmt.Errorf("unknown condition %q", a.Condition)
+	}
+	if a.ID == "" {
+		a.ID = newEpisodeID()
+		a.Active = true
+	}
+	if a.CreatedAt.IsZero() {
+		a.CreatedAt = time.Now()
+	}
+
+	ae.mu.Lock()
+	defer ae.mu.Unlock()
+	if existing, ok := ae.alerts[a.ID]; ok && existing.User != a.User {
+		return a, ErrAlertNotFound
+	}
+	ae.alerts[a.ID] = &alertState{Alert: a}
+	return a, nil
+}
+
+// Delete removes one of user's alerts.
+func (ae *AlertEngine) Delete(id, user string) error {
+	ae.mu.Lock()
+	defer ae.mu.Unlock()
+	as, ok := ae.alerts[id]
+	if !ok || as.User != user {
+		return ErrAlertNotFound
+	}
+	delete(ae.alerts, id)
+	return nil
+}
+
+// Alerts returns user's alerts, or every alert when user is empty.
+func (ae *AlertEngine) Alerts(user string) []Alert {
+	ae.mu.Lock()
+	defer ae.mu.Unlock()
+	out := []Alert{}
+	for _, as := range ae.alerts {
+		if user == "" || as.User == user {
+			out = append(out, as.Alert)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.Before(out[j].CreatedAt) })
+	return out
+}
+
+// Symbols lists the symbols with active alerts so they get polled.
+func (ae *AlertEngine) Symbols() []string {
+	ae.mu.Lock()
+	defer ae.mu.Unlock()
+	seen := make(map[string]bool)
+	var out []string
+	for _, as := range ae.alerts {
+		if as.Active && !seen[as.Symbol] {
+			seen[as.Symbol] = true
+			out = append(out, as.Symbol)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// Evaluate checks every active alert on symbol against a new quote. An alert
+// triggers when its condition starts holding; the first quote an alert sees
+// only establishes whether it is armed, so a crossing alert never fires just
+// because the price was already past its level.
+func (ae *AlertEngine) Evaluate(symbol string, price, previousClose float64, now time.Time) []AlertTrigger {
+	if price <= 0 {
+		return nil
+	}
+	changePct := 0.0
+	if previousClose > 0 {
+		changePct = (price - previousClose) / previousClose * 100
+	}
+
+	ae.mu.Lock()
+	defer ae.mu.Unlock()
+
+	var triggers []AlertTrigger
+	for _, as := range ae.alerts {
+		if !as.Active || as.Symbol != symbol {
+			continue
+		}
+		var holds bool
+		var message string
+		switch as.Condition {
+		case AlertCrossesAbove:
+			holds = price >= as.Value
+			message = fmt.Sprintf("%s crossed above %.2f at %.2f.", symbol, as.Value, price)
+		case AlertCrossesBelow:
+			holds = price <= as.Value
+			message = fmt.Sprintf("%s crossed below %.2f at %.2f.", symbol, as.Value, price)
+		case AlertRisesPct:
+			holds = previousClose > 0 && changePct >= as.Value
+			message = fmt.Sprintf("%s is up %.2f%% on the day at %.2f.", symbol, changePct, price)
+		case AlertDropsPct:
+			holds = previousClose > 0 && changePct <= -as.Value
+			message = fmt.Sprintf("%s is down %.2f%% on the day at %.2f.", symbol, -changePct, price)
+		}
+
+		// Percentage alerts are level-based, so they may fire on the first quote
+		firstSeen := !as.seen
+		as.seen = true
+		if firstSeen && (as.Condition == AlertCrossesAbove || as.Condition == AlertCrossesBelow) {
+			as.armed = !holds
+			continue
+		}
+		if firstSeen {
+			as.armed = true
+		}
+		if !holds {
+			as.armed = true
+			continue
+		}
+		if !as.armed {
+			continue
+		}
+
+		as.armed = false
+		triggered := now
+		as.LastTriggered = &triggered
+		if !as.Repeat {
+			as.Active = false
+		}
+		triggers = append(triggers, AlertTrigger{
+			Alert:     as.Alert,
+			Price:     price,
+			ChangePct: changePct,
+			Message:   message,
+			Time:      now,
+		})
+	}
+	return triggers
+}
@@ -3,35 +3,91 @@ package analytics
 import (
 	"fmt"
 	"math"
+	"time"
 )
 
+// Anomaly is a detector finding. Magnitude is a detector-specific measure of
+// how extreme the finding is and drives escalation; Confidence is internal and
+// is published as Severity. The episode fields are filled in by EpisodeTracker
+// and ID is assigned when the event is published.
 type Anomaly struct {
-	Symbol     string  `json:"symbol"`
-	Type       string  `json:"type"` // "volume_spike", "price_jump", "momentum"
-	Confidence float64 `json:"confidence"`
-	Details    string  `json:"details"`
-}
-
-func DetectAnomaly(symbol string, price, volume float64, metrics RollingMetrics) *Anomaly {
-	// 1. Price Jump Detection
-	if math.Abs(metrics.PriceChange) > 2.0 {
-		return &Anomaly{
-			Symbol:     symbol,
-			Type:       "price_jump",
-			Confidence: math.Min(0.95, 0.5+math.Abs(metrics.PriceChange)/10.0),
-			Details:    fmt.Sprintf("Sudden momentum shift: %.2f%% price move detected.", metrics.PriceChange),
-		}
+	ID         string     `json:"id"`
+	Symbol     string     `json:"symbol"`
+	Type       string     `json:"type"` // "price_jump", "high_volatility_spike", "return_outlier", "volume_outlier", "volume_spike", "correlation_breakdown", "spread_entry", "spread_exit", "opening_gap", "gap_filled", "close_deviation", "multivariate_outlier"
+	Detector   string     `json:"detector"`
+	Severity   Severity   `json:"severity"`
+	Status     string     `json:"status"`
+	EpisodeID  string     `json:"episode_id"`
+	StartedAt  time.Time  `json:"started_at"`
+	EndedAt    *time.Time `json:"ended_at,omitempty"`
+	Magnitude  float64    `json:"magnitude"`
+	Confidence float64    `json:"-"`
+	Details    string     `json:"details"`
+}
+
+// PriceJumpDetector flags a large percentage move across the rolling window.
+type PriceJumpDetector struct {
+	ThresholdPct float64 `json:"threshold_pct"`
+}
+
+func NewPriceJumpDetector() *PriceJumpDetector {
+	return &PriceJumpDetector{ThresholdPct: 2.0}
+}
+
+func (d *PriceJumpDetector) Name() string { return "price_jump" }
+
+func (d *PriceJumpDetector) Validate() error {
+	if d.ThresholdPct <= 0 {
+		return fmt.Errorf("threshold_pct must be positive")
 	}
+	return nil
+}
 
-	// 2. Volume Spike Detection (assuming high volatility correlates with volume spikes in our ring buffer)
-	if metrics.Volatility > 1.0 && metrics.VWAP > 0 {
-		return &Anomaly{
-			Symbol:     symbol,
-			Type:       "high_volatility_spike",
-			Confidence: 0.8,
-			Details:    "Aggressive trading activity detected with elevated volatility.",
-		}
+func (d *PriceJumpDetector) Detect(obs Observation) []Anomaly {
+	change := obs.Metrics.PriceChange
+	if math.Abs(change) <= d.ThresholdPct {
+		return nil
 	}
+	return []Anomaly{{
+		Symbol:     obs.Symbol,
+		Type:       "price_jump",
+		Magnitude:  math.Abs(change),
+		Confidence: math.Min(0.95, 0.5+math.Abs(change)/10.0),
+		Details:    fmt.Sprintf("Sudden momentum shift: %.2f%% price move detected.", change),
+	}}
+}
 
+// VolatilitySpikeDetector flags elevated volatility from the engine's
+// selected estimator while there is traded volume. Threshold is in the
+// estimator's units: an annualized fraction by default, so 0.8 is two to
+// three times a typical large cap's volatility. With price_stddev it is in
+// price units and has to be configured per deployment.
+type VolatilitySpikeDetector struct {
+	Threshold float64 `json:"threshold"`
+}
+
+func NewVolatilitySpikeDetector() *VolatilitySpikeDetector {
+	return &VolatilitySpikeDetector{Threshold: 0.8}
+}
+
+func (d *VolatilitySpikeDetector) Name() string { return "volatility_spike" }
+
+func (d *VolatilitySpikeDetector) Validate() error {
+	if d.Threshold <= 0 {
+		return fmt.Errorf("threshold must be positive")
+	}
 	return nil
 }
+
+func (d *VolatilitySpikeDetector) Detect(obs Observation) []Anomaly {
+	if obs.Metrics.Volatility <= d.Threshold || obs.Metrics.VWAP <= 0 {
+		return nil
+	}
+	return []Anomaly{{
+		Symbol:     obs.Symbol,
+		Type:       "high_volatility_spike",
+		Magnitude:  obs.Metrics.Volatility,
+		Confidence: 0.8,
+		Details:    "Aggressive trading activity detected with elevated volatility.",
+	}}
+}
@@ -0,0 +1,233 @@
+package analytics
+
+import (
+	"context"
+	"sort"
+	"time"
+)
+
+// LabelledEvent is a known event to score a backtest against. An empty Type
+// matches any anomaly type or detector, and a zero End means the event is
+// a single instant.
+type LabelledEvent struct {
+	Symbol string    `json:"symbol"`
+	Type   string    `json:"type,omitempty"`
+	Start  time.Time `json:"start"`
+	End    time.Time `json:"end,omitempty"`
+}
+
+type BacktestOptions struct {
+	Cooldown     time.Duration
+	ResolveAfter time.Duration
+	Tolerance    time.Duration // slack around labelled events when matching
+	MaxEvents    int
+}
+
+type BacktestCount struct {
+	Findings int `json:"findings"`
+	Episodes int `json:"episodes"`
+}
+
+// LabelOverlap scores episodes against labelled events. Lead time is how
+// long before the labelled start an episode opened, so detections that come
+// late are negative.
+type LabelOverlap struct {
+	Labels          int             `json:"labels"`
+	Detected        int             `json:"detected"`
+	Missed          []LabelledEvent `json:"missed"`
+	MatchedEpisodes int             `json:"matched_episodes"`
+	FalsePositives  int             `json:"false_positives"`
+	Precision       float64         `json:"precision"`
+	Recall          float64         `json:"recall"`
+	MeanLeadSeconds float64         `json:"mean_lead_seconds"`
+}
+
+type BacktestReport struct {
+	Symbols            []string                  `json:"symbols"`
+	Ticks              int                       `json:"ticks"`
+	From               time.Time                 `json:"from"`
+	To                 time.Time                 `json:"to"`
+	Findings           int                       `json:"findings"` // raw detector output before episode grouping
+	Episodes           int                       `json:"episodes"`
+	ByDetector         map[string]*BacktestCount `json:"by_detector"`
+	BySymbol           map[string]*BacktestCount `json:"by_symbol"`
+	EpisodesByHour     [24]int                   `json:"episodes_by_hour"` // market-local hour each episode opened
+	MeanEpisodeSeconds float64                   `json:"mean_episode_seconds"`
+	Events             []Anomaly                 `json:"events"` // episode openings, oldest first
+	Truncated          bool                      `json:"truncated"`
+	Overlap            *LabelOverlap             `json:"overlap,omitempty"`
+}
+
+// Backtest replays stored ticks through an engine and detector registry,
+// both of which should be fresh, grouping findings into episodes exactly as
+// the live pipeline does. Tick volume must be interval volume. Session open,
+// high, low and previous close are rebuilt from the ticks themselves. The
+// replay stops with ctx's error once ctx is done.
+func Backtest(ctx context.Context, history map[string][]Tick, engine *Engine, detectors *DetectorRegistry, labels []LabelledEvent, opts BacktestOptions) (BacktestReport, error) {
+	// Forests train inline so the same replay always gives the same report
+	for _, s := range detectors.Statuses() {
+		if f, ok := s.Config.(*IsolationForestDetector); ok {
+			f.Synchronous = true
+		}
+	}
+	report := BacktestReport{
+		ByDetector: make(map[string]*BacktestCount),
+		BySymbol:   make(map[string]*BacktestCount),
+	}
+	var episodes []Anomaly
+	var totalDuration time.Duration
+	var resolvedCount int
+
+	for symbol := range history {
+		report.Symbols = append(report.Symbols, symbol)
+	}
+	sort.Strings(report.Symbols)
+
+	count := func(m map[string]*BacktestCount, key string) *BacktestCount {
+		c, ok := m[key]
+		if !ok {
+			c = &BacktestCount{}
+			m[key] = c
+		}
+		return c
+	}
+
+	for _, symbol := range report.Symbols {
+		ticks := history[symbol]
+		if len(ticks) == 0 {
+			continue
+		}
+		tracker := NewEpisodeTracker(opts.Cooldown, opts.ResolveAfter, 0.5)
+		starts := make(map[string]time.Time)
+		resolve := func(now time.Time) {
+			for _, r := range tracker.Sweep(now) {
+				totalDuration += r.EndedAt.Sub(starts[r.EpisodeID])
+				resolvedCount++
+			}
+		}
+
+		var day string
+		var prevClose, lastPrice, open, high, low float64
+		for i, t := range ticks {
+			if i%1000 == 0 {
+				if err := ctx.Err(); err != nil {
+					return report, err
+				}
+			}
+			if t.Price <= 0 {
+				continue
+			}
+			if d := t.Time.In(marketLocation).Format("2006-01-02"); d != day {
+				if day != "" {
+					prevClose = lastPrice
+				}
+				day, open, high, low = d, t.Price, t.Price, t.Price
+			}
+			if t.Price > high {
+				high = t.Price
+			}
+			if t.Price < low {
+				low = t.Price
+			}
+			lastPrice = t.Price
+			t.Open, t.High, t.Low = open, high, low
+
+			if report.Ticks == 0 || t.Time.Before(report.From) {
+				report.From = t.Time
+			}
+			if t.Time.After(report.To) {
+				report.To = t.Time
+			}
+			report.Ticks++
+
+			m := engine.Process(symbol, t)
+			for _, a := range detectors.Run(Observation{
+				Symbol:        symbol,
+				Tick:          t,
+				PreviousClose: prevClose,
+				TradingDay:    day,
+				Metrics:       m,
+			}) {
+				report.Findings++
+				count(report.ByDetector, a.Detector).Findings++
+				count(report.BySymbol, symbol).Findings++
+
+				ev := tracker.Observe(a, t.Time)
+				if ev == nil || ev.Status != StatusOpen {
+					continue
+				}
+				starts[ev.EpisodeID] = ev.StartedAt
+				report.Episodes++
+				count(report.ByDetector, ev.Detector).Episodes++
+				count(report.BySymbol, symbol).Episodes++
+				report.EpisodesByHour[ev.StartedAt.In(marketLocation).Hour()]++
+				episodes = append(episodes, *ev)
+			}
+			resolve(t.Time)
+		}
+		// Close whatever is still open at the end of the replay
+		resolve(ticks[len(ticks)-1].Time.Add(opts.ResolveAfter))
+	}
+
+	if resolvedCount > 0 {
+		report.MeanEpisodeSeconds = totalDuration.Seconds() / float64(resolvedCount)
+	}
+	sort.Slice(episodes, func(i, j int) bool { return episodes[i].StartedAt.Before(episodes[j].StartedAt) })
+	if len(labels) > 0 {
+		report.Overlap = scoreLabels(episodes, labels, opts.Tolerance)
+	}
+	report.Events = episodes
+	if opts.MaxEvents > 0 && len(episodes) > opts.MaxEvents {
+		report.Events = episodes[:opts.MaxEvents]
+		report.Truncated = true
+	}
+	return report, nil
+}
+
+func scoreLabels(episodes []Anomaly, labels []LabelledEvent, tolerance time.Duration) *LabelOverlap {
+	o := &LabelOverlap{Labels: len(labels), Missed: []LabelledEvent{}}
+	matched := make([]bool, len(episodes))
+	var leadTotal time.Duration
+	for _, l := range labels {
+		end := l.End
+		if end.IsZero() {
+			end = l.Start
+		}
+		from, to := l.Start.Add(-tolerance), end.Add(tolerance)
+		var first *Anomaly
+		for i := range episodes {
+			ep := &episodes[i]
+			if ep.Symbol != l.Symbol || (l.Type != "" && l.Type != ep.Type && l.Type != ep.Detector) {
+				continue
+			}
+			if ep.StartedAt.Before(from) || ep.StartedAt.After(to) {
+				continue
+			}
+			matched[i] = true
+			if first == nil {
+				first = ep
+			}
+		}
+		if first == nil {
+			o.Missed = append(o.Missed, l)
+			continue
+		}
+		o.Detected++
+		leadTotal += l.Start.Sub(first.StartedAt)
+	}
+	for _, m := range matched {
+		if m {
+			o.MatchedEpisodes++
+		} else {
+			o.FalsePositives++
+		}
+	}
+	if len(episodes) > 0 {
+		o.Precision = float64(o.MatchedEpisodes) / float64(len(episodes))
+	}
+	o.Recall = float64(o.Detected) / float64(o.Labels)
+	if o.Detected > 0 {
+		o.MeanLeadSeconds = leadTotal.Seconds() / float64(o.Detected)
+	}
+	return o
+}
@@ -0,0 +1,239 @@
+package analytics
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const basketBaseValue = 100.0
+
+var basketNamePattern = regexp.MustCompile(`^[A-Z0-9_.^-]{1,10}$`)
+
+// Basket is a weighted set of symbols tracked as a synthetic index. Base holds
+// the constituent prices at which the index was 100; it is set automatically
+// the first time every constituent has been priced.
+type Basket struct {
+	Name    string             `json:"name"`
+	Weights map[string]float64 `json:"weights"`
+	Base    map[string]float64 `json:"base,omitempty"`
+}
+
+type BasketValue struct {
+	Name       string
+	Value      float64
+	Volume     int64 // combined cumulative session volume of the constituents
+	TradingDay string
+	Rebased    bool // Base was set by this update and should be persisted
+}
+
+type BasketEngine struct {
+	// IsSymbol, if set, reports whether symbol is a real ticker in use, so a
+	// basket can't take over its polling.
+	IsSymbol func(symbol string) bool
+
+	baskets map[string]*Basket
+	prices  map[string]float64
+	volumes map[string]int64
+	mu      sync.Mutex
+}
+
+func NewBasketEngine() *BasketEngine {
+	return &BasketEngine{
+		baskets: make(map[string]*Basket),
+		prices:  make(map[string]float64),
+		volumes: make(map[string]int64),
+	}
+}
+
+func (be *BasketEngine) Validate(b Basket) error {
+	if !basketNamePattern.MatchString(b.Name) {
+		return fmt.Errorf("basket name must be 1-10 characters of A-Z, 0-9, '_', '.', '^' or '-'")
+	}
+	if len(b.Weights) == 0 {
+		return fmt.Errorf("basket %s has no constituents", b.Name)
+	}
+	if !be.IsBasket(b.Name) && be.IsSymbol != nil && be.IsSymbol(b.Name) {
+		return fmt.Errorf("%s is a live symbol and cannot be a basket name", b.Name)
+	}
+	if other, ok := be.constituentOf(b.Name); ok {
+		return fmt.Errorf("%s is a constituent of basket %s and cannot be a basket name", b.Name, other)
+	}
+	var total float64
+	for symbol, w := range b.Weights {
+		if symbol == b.Name {
+			return fmt.Errorf("basket %s cannot contain itself", b.Name)
+		}
+		if be.IsBasket(symbol) {
+			return fmt.Errorf("basket %s cannot contain basket %s", b.Name, symbol)
+		}
+		total += w
+	}
+	if total == 0 {
+		return fmt.Errorf("basket %s weights sum to zero", b.Name)
+	}
+	return nil
+}
+
+func (be *BasketEngine) Set(b Basket) error {
+	b.Name = strings.ToUpper(b.Name)
+	weights := make(map[string]float64, len(b.Weights))
+	for symbol, w := range b.Weights {
+		weights[strings.ToUpper(symbol)] = w
+	}
+	b.Weights = weights
+	if err := be.Validate(b); err != nil {
+		return err
+	}
+	// A changed constituent list invalidates the old base
+	if len(b.Base) != len(b.Weights) {
+		b.Base = nil
+	}
+	for symbol := range b.Base {
+		if _, ok := b.Weights[symbol]; !ok {
+			b.Base = nil
+			break
+		}
+	}
+
+	be.mu.Lock()
+	be.baskets[b.Name] = &b
+	be.mu.Unlock()
+	return nil
+}
+
+func (be *BasketEngine) Delete(name string) bool {
+	be.mu.Lock()
+	defer be.mu.Unlock()
+	if _, ok := be.baskets[name]; !ok {
+		return false
+	}
+	delete(be.baskets, name)
+	return true
+}
+
+func (be *BasketEngine) Get(name string) (Basket, bool) {
+	be.mu.Lock()
+	defer be.mu.Unlock()
+	b, ok := be.baskets[name]
+	if !ok {
+		return Basket{}, false
+	}
+	return *b, true
+}
+
+func (be *BasketEngine) IsBasket(symbol string) bool {
+	be.mu.Lock()
+	defer be.mu.Unlock()
+	_, ok := be.baskets[symbol]
+	return ok
+}
+
+// constituentOf returns a basket that holds symbol, if any.
+func (be *BasketEngine) constituentOf(symbol string) (string, bool) {
+	be.mu.Lock()
+	defer be.mu.Unlock()
+	for name, b := range be.baskets {
+		if _, ok := b.Weights[symbol]; ok {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+func (be *BasketEngine) Baskets() []Basket {
+	be.mu.Lock()
+	defer be.mu.Unlock()
+	out := make([]Basket, 0, len(be.baskets))
+	for _, b := range be.baskets {
+		out = append(out, *b)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// Expand replaces basket names with their constituents so that the symbols
+// that actually need polling are returned, without duplicates.
+func (be *BasketEngine) Expand(symbols []string) []string {
+	be.mu.Lock()
+	defer be.mu.Unlock()
+
+	seen := make(map[string]bool)
+	var out []string
+	add := func(s string) {
+		if !seen[s] {
+			seen[s] = true
+			out = append(out, s)
+		}
+	}
+	for _, s := range symbols {
+		if b, ok := be.baskets[s]; ok {
+			constituents := make([]string, 0, len(b.Weights))
+			for c := range b.Weights {
+				constituents = append(constituents, c)
+			}
+			sort.Strings(constituents)
+			for _, c := range constituents {
+				add(c)
+			}
+			continue
+		}
+		add(s)
+	}
+	return out
+}
+
+// Update records a constituent quote and returns the new value of every
+// basket containing symbol whose constituents have all been priced.
+func (be *BasketEngine) Update(symbol string, price float64, volume int64, tradingDay string) []BasketValue {
+	if price <= 0 {
+		return nil
+	}
+	be.mu.Lock()
+	defer be.mu.Unlock()
+
+	be.prices[symbol] = price
+	be.volumes[symbol] = volume
+
+	var values []BasketValue
+	for _, b := range be.baskets {
+		if _, ok := b.Weights[symbol]; !ok {
+			continue
+		}
+		v, ok := be.value(b)
+		if !ok {
+			continue
+		}
+		v.TradingDay = tradingDay
+		values = append(values, v)
+	}
+	return values
+}
+
+func (be *BasketEngine) value(b *Basket) (BasketValue, bool) {
+	for symbol := range b.Weights {
+		if _, ok := be.prices[symbol]; !ok {
+			return BasketValue{}, false
+		}
+	}
+
+	v := BasketValue{Name: b.Name}
+	if b.Base == nil {
+		b.Base = make(map[string]float64, len(b.Weights))
+		for symbol := range b.Weights {
+			b.Base[symbol] = be.prices[symbol]
+		}
+		v.Rebased = true
+	}
+
+	var weighted, total float64
+	for symbol, w := range b.Weights {
+		weighted += w * be.prices[symbol] / b.Base[symbol]
+		total += w
+		v.Volume += be.volumes[symbol]
+	}
+	v.Value = basketBaseValue * weighted / total
+	return v, true
+}
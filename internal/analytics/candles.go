@@ -0,0 +1,106 @@
+package analytics
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+var DefaultResolutions = []time.Duration{time.Minute, 5 * time.Minute, 15 * time.Minute, time.Hour}
+
+type Candle struct {
+	Symbol     string    `json:"symbol"`
+	Resolution string    `json:"resolution"`
+	Start      time.Time `json:"start"`
+	Open       float64   `json:"open"`
+	High       float64   `json:"high"`
+	Low        float64   `json:"low"`
+	Close      float64   `json:"close"`
+	Volume     float64   `json:"volume"`
+}
+
+type CandleAggregator struct {
+	resolutions []time.Duration
+	open        map[string]map[time.Duration]*Candle
+	mu          sync.Mutex
+}
+
+func NewCandleAggregator(resolutions []time.Duration) *CandleAggregator {
+	return &CandleAggregator{
+		resolutions: resolutions,
+		open:        make(map[string]map[time.Duration]*Candle),
+	}
+}
+
+// Add folds a tick into the open bar of every resolution and returns any bars
+// the tick closed by crossing into a new period.
+func (ca *CandleAggregator) Add(symbol string, price, volume float64, ts time.Time) []Candle {
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+
+	bars, ok := ca.open[symbol]
+	if !ok {
+		bars = make(map[time.Duration]*Candle)
+		ca.open[symbol] = bars
+	}
+
+	var closed []Candle
+	for _, res := range ca.resolutions {
+		start := ts.Truncate(res)
+		c, ok := bars[res]
+		if ok && !start.After(c.Start) {
+			if price > c.High {
+				c.High = price
+			}
+			if price < c.Low {
+				c.Low = price
+			}
+			c.Close = price
+			c.Volume += volume
+			continue
+		}
+		if ok {
+			closed = append(closed, *c)
+		}
+		bars[res] = &Candle{
+			Symbol:     symbol,
+			Resolution: ResolutionName(res),
+			Start:      start,
+			Open:       price,
+			High:       price,
+			Low:        price,
+			Close:      price,
+			Volume:     volume,
+		}
+	}
+	return closed
+}
+
+// Flush closes every open bar whose period has ended by now, so bars are
+// finalized on time boundaries even when a symbol stops ticking.
+func (ca *CandleAggregator) Flush(now time.Time) []Candle {
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+
+	var closed []Candle
+	for _, bars := range ca.open {
+		for res, c := range bars {
+			if !now.Before(c.Start.Add(res)) {
+				closed = append(closed, *c)
+				delete(bars, res)
+			}
+		}
+	}
+	sort.Slice(closed, func(i, j int) bool {
+		return closed[i].Start.Before(closed[j].Start)
+	})
+	return closed
+}
+
+func ResolutionName(d time.Duration) string {
+	if d%time.Hour == 0 {
+		return fmt.Sprintf("%dh", d/time.Hour)
+	}
+	return fmt.Sprintf("%dm", d/time.Minute)
+}
@@ -0,0 +1,184 @@
+package analytics
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+)
+
+// CorrelationTracker samples the latest price of every symbol on a common
+// clock so that return series line up across symbols regardless of when each
+// one was polled.
+type CorrelationTracker struct {
+	latest   map[string]float64
+	sampled  map[string]float64
+	returns  map[string][]float64 // NaN where the symbol had no return that interval
+	length   int
+	capacity int
+	mu       sync.RWMutex
+}
+
+type CorrelationMatrix struct {
+	Symbols []string     `json:"symbols"`
+	Window  int          `json:"window"`
+	Values  [][]*float64 `json:"values"` // null where there is not enough overlapping data
+}
+
+func NewCorrelationTracker(capacity int) *CorrelationTracker {
+	return &CorrelationTracker{
+		latest:   make(map[string]float64),
+		sampled:  make(map[string]float64),
+		returns:  make(map[string][]float64),
+		capacity: capacity,
+	}
+}
+
+func (ct *CorrelationTracker) Observe(symbol string, price float64) {
+	if price <= 0 {
+		return
+	}
+	ct.mu.Lock()
+	ct.latest[symbol] = price
+	ct.mu.Unlock()
+}
+
+// Sample closes the current interval, appending one log return per symbol.
+func (ct *CorrelationTracker) Sample() {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+
+	for symbol, price := range ct.latest {
+		series, ok := ct.returns[symbol]
+		if !ok {
+			series = make([]float64, ct.length)
+			for i := range series {
+				series[i] = math.NaN()
+			}
+		}
+		r := math.NaN()
+		if prev, ok := ct.sampled[symbol]; ok {
+			r = math.Log(price / prev)
+		}
+		ct.sampled[symbol] = price
+		series = append(series, r)
+		if len(series) > ct.capacity {
+			series = series[len(series)-ct.capacity:]
+		}
+		ct.returns[symbol] = series
+	}
+	if ct.length < ct.capacity {
+		ct.length++
+	}
+}
+
+func (ct *CorrelationTracker) Symbols() []string {
+	ct.mu.RLock()
+	defer ct.mu.RUnlock()
+	symbols := make([]string, 0, len(ct.returns))
+	for s := range ct.returns {
+		symbols = append(symbols, s)
+	}
+	sort.Strings(symbols)
+	return symbols
+}
+
+// Returns gives the aligned return series for both symbols over the last
+// window intervals, keeping only intervals where both have a value.
+func (ct *CorrelationTracker) Returns(a, b string, window int) ([]float64, []float64) {
+	ct.mu.RLock()
+	defer ct.mu.RUnlock()
+	return alignedReturns(ct.returns[a], ct.returns[b], window)
+}
+
+func (ct *CorrelationTracker) Matrix(symbols []string, window int) CorrelationMatrix {
+	ct.mu.RLock()
+	defer ct.mu.RUnlock()
+
+	m := CorrelationMatrix{
+		Symbols: symbols,
+		Window:  window,
+		Values:  make([][]*float64, len(symbols)),
+	}
+	for i := range symbols {
+		m.Values[i] = make([]*float64, len(symbols))
+	}
+	for i, a := range symbols {
+		for j := i; j < len(symbols); j++ {
+			if c, ok := ct.correlation(a, symbols[j], window); ok {
+				m.Values[i][j] = &c
+				m.Values[j][i] = &c
+			}
+		}
+	}
+	return m
+}
+
+// Breakdowns flags pairs that were correlated at or above minCorr over
+// longWindow but whose correlation over shortWindow fell by at least drop.
+// One anomaly is produced for each leg of a broken pair.
+func (ct *CorrelationTracker) Breakdowns(longWindow, shortWindow int, minCorr, drop float64) []Anomaly {
+	ct.mu.RLock()
+	defer ct.mu.RUnlock()
+
+	symbols := make([]string, 0, len(ct.returns))
+	for s := range ct.returns {
+		symbols = append(symbols, s)
+	}
+	sort.Strings(symbols)
+
+	var anomalies []Anomaly
+	for i, a := range symbols {
+		for _, b := range symbols[i+1:] {
+			long, ok := ct.correlation(a, b, longWindow)
+			if !ok || long < minCorr {
+				continue
+			}
+			short, ok := ct.correlation(a, b, shortWindow)
+			if !ok || long-short < drop {
+				continue
+			}
+			for _, pair := range [][2]string{{a, b}, {b, a}} {
+				anomalies = append(anomalies, Anomaly{
+					Symbol:     pair[0],
+					Type:       "correlation_breakdown",
+					Detector:   "correlation",
+					Magnitude:  long - short,
+					Confidence: math.Min(0.95, 0.5+(long-short)/2),
+					Details:    fmt.Sprintf("Correlation with %s fell from %.2f to %.2f.", pair[1], long, short),
+				})
+			}
+		}
+	}
+	return anomalies
+}
+
+func (ct *CorrelationTracker) correlation(a, b string, window int) (float64, bool) {
+	if a == b {
+		return 1, true
+	}
+	x, y := alignedReturns(ct.returns[a], ct.returns[b], window)
+	return pearson(x, y)
+}
+
+func alignedReturns(a, b []float64, window int) ([]float64, []float64) {
+	n := len(a)
+	if len(b) < n {
+		n = len(b)
+	}
+	if window > 0 && window < n {
+		n = window
+	}
+	a, b = a[len(a)-n:], b[len(b)-n:]
+
+	x := make([]float64, 0, n)
+	y := make([]float64, 0, n)
+	for i := 0; i < n; i++ {
+		if math.IsNaN(a[i]) || math.IsNaN(b[i]) {
+			continue
+		}
+		x = append(x, a[i])
+		y = append(y, b[i])
+	}
+	return x, y
+}
@@ -0,0 +1,226 @@
+package analytics
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// Observation is everything a detector sees about a single tick.
+type Observation struct {
+	Symbol        string
+	Tick          Tick
+	PreviousClose float64
+	TradingDay    string
+	Metrics       RollingMetrics
+}
+
+// Detector inspects an observation and returns every anomaly it finds.
+// Detectors keep their configuration in exported, JSON-tagged fields so it
+// can be loaded with DetectorRegistry.Configure.
+type Detector interface {
+	Name() string
+	Detect(obs Observation) []Anomaly
+}
+
+// Seeder is implemented by detectors that can build their baseline from
+// stored history before live ticks arrive.
+type Seeder interface {
+	Seed(symbol string, history []Tick)
+}
+
+// Validator is implemented by detectors whose configuration has limits.
+// Configure rejects a configuration that fails validation.
+type Validator interface {
+	Validate() error
+}
+
+type DetectorStatus struct {
+	Name    string   `json:"name"`
+	Enabled bool     `json:"enabled"`
+	Config  Detector `json:"config"`
+}
+
+type DetectorRegistry struct {
+	detectors []Detector
+	enabled   map[string]bool
+	mu        sync.RWMutex
+}
+
+func NewDetectorRegistry() *DetectorRegistry {
+	return &DetectorRegistry{
+		enabled: make(map[string]bool),
+	}
+}
+
+// DefaultDetectors builds a registry with the built-in detectors. The
+// isolation forest is registered disabled and has to be enabled explicitly.
+func DefaultDetectors() *DetectorRegistry {
+	r := NewDetectorRegistry()
+	r.Register(NewPriceJumpDetector(), true)
+	r.Register(NewVolatilitySpikeDetector(), true)
+	r.Register(NewRobustZScoreDetector(), true)
+	r.Register(NewVolumeSpikeDetector(), true)
+	r.Register(NewIsolationForestDetector(), false)
+	return r
+}
+
+func (r *DetectorRegistry) Register(d Detector, enabled bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, existing := range r.detectors {
+		if existing.Name() == d.Name() {
+			r.detectors[i] = d
+			r.enabled[d.Name()] = enabled
+			return
+		}
+	}
+	r.detectors = append(r.detectors, d)
+	r.enabled[d.Name()] = enabled
+}
+
+func (r *DetectorRegistry) Get(name string) (Detector, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, d := range r.detectors {
+		if d.Name() == name {
+			return d, true
+		}
+	}
+	return nil, false
+}
+
+func (r *DetectorRegistry) SetEnabled(name string, enabled bool) error {
+	if _, ok := r.Get(name); !ok {
+		return fmt.Errorf("unknown detector %q", name)
+	}
+	r.mu.Lock()
+	r.enabled[name] = enabled
+	r.mu.Unlock()
+	return nil
+}
+
+// EnableOnly enables the named detectors and disables the rest.
+func (r *DetectorRegistry) EnableOnly(names []string) error {
+	for _, name := range names {
+		if _, ok := r.Get(name); !ok {
+			return fmt.Errorf("unknown detector %q", name)
+		}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for name := range r.enabled {
+		r.enabled[name] = false
+	}
+	for _, name := range names {
+		r.enabled[name] = true
+	}
+	return nil
+}
+
+// Configure decodes a JSON object keyed by detector name into each
+// detector's configuration fields. Every configuration is decoded into a
+// scratch copy of its detector and validated first, so either the whole
+// config is applied or none of it is.
+func (r *DetectorRegistry) Configure(data []byte) error {
+	var configs map[string]json.RawMessage
+	if err := json.Unmarshal(data, &configs); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	staged := make(map[Detector][]byte, len(configs))
+	for name, raw := range configs {
+		var target Detector
+		for _, d := range r.detectors {
+			if d.Name() == name {
+				target = d
+			}
+		}
+		if target == nil {
+			return fmt.Errorf("unknown detector %q", name)
+		}
+		config, err := stageConfig(target, raw)
+		if err != nil {
+			return fmt.Errorf("detector %s: %w", name, err)
+		}
+		staged[target] = config
+	}
+	for target, config := range staged {
+		if err := json.Unmarshal(config, target); err != nil {
+			return fmt.Errorf("detector %s: %w", target.Name(), err)
+		}
+	}
+	return nil
+}
+
+// stageConfig layers raw over d's current configuration in a fresh value of
+// the same type and returns the validated result.
+func stageConfig(d Detector, raw json.RawMessage) ([]byte, error) {
+	t := reflect.TypeOf(d)
+	if t.Kind() != reflect.Pointer {
+		return nil, fmt.Errorf("not configurable")
+	}
+	current, err := json.Marshal(d)
+	if err != nil {
+		return nil, err
+	}
+	scratch := reflect.New(t.Elem()).Interface()
+	if err := json.Unmarshal(current, scratch); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(raw, scratch); err != nil {
+		return nil, err
+	}
+	if v, ok := scratch.(Validator); ok {
+		if err := v.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	return json.Marshal(scratch)
+}
+
+func (r *DetectorRegistry) Statuses() []DetectorStatus {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	out := make([]DetectorStatus, len(r.detectors))
+	for i, d := range r.detectors {
+		out[i] = DetectorStatus{Name: d.Name(), Enabled: r.enabled[d.Name()], Config: d}
+	}
+	return out
+}
+
+// Seed hands historical ticks, oldest first, to every detector that can use them.
+func (r *DetectorRegistry) Seed(symbol string, history []Tick) {
+	r.mu.RLock()
+	detectors := append([]Detector(nil), r.detectors...)
+	r.mu.RUnlock()
+	for _, d := range detectors {
+		if s, ok := d.(Seeder); ok {
+			s.Seed(symbol, history)
+		}
+	}
+}
+
+// Run passes the observation to every enabled detector and collects all of
+// their findings, tagged with the detector that produced them.
+func (r *DetectorRegistry) Run(obs Observation) []Anomaly {
+	r.mu.RLock()
+	detectors := make([]Detector, 0, len(r.detectors))
+	for _, d := range r.detectors {
+		if r.enabled[d.Name()] {
+			detectors = append(detectors, d)
+		}
+	}
+	r.mu.RUnlock()
+
+	var anomalies []Anomaly
+	for _, d := range detectors {
+		for _, a := range d.Detect(obs) {
+			a.Detector = d.Name()
+			anomalies = append(anomalies, a)
+		}
+	}
+	return anomalies
+}
@@ -0,0 +1,59 @@
+package analytics
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestConfigureValidates(t *testing.T) {
+	r := NewDetectorRegistry()
+	jump := NewPriceJumpDetector()
+	spike := NewVolatilitySpikeDetector()
+	spikeThreshold := spike.Threshold
+	r.Register(jump, true)
+	r.Register(spike, true)
+	zscore := NewRobustZScoreDetector()
+	r.Register(zscore, true)
+	r.Register(NewVolumeSpikeDetector(), true)
+	r.Register(NewGapDetector(), true)
+	r.Register(NewIsolationForestDetector(), true)
+
+	if err := r.Configure([]byte(`{"price_jump":{"threshold_pct":5}}`)); err != nil {
+		t.Fatalf("valid config rejected: %v", err)
+	}
+	if jump.ThresholdPct != 5 || spike.Threshold != spikeThreshold {
+		t.Errorf("thresholds = %v, %v, want 5, %v", jump.ThresholdPct, spike.Threshold, spikeThreshold)
+	}
+
+	tests := []struct {
+		config string
+		want   string // substring of the error
+	}{
+		{`{"price_jump":{"threshold_pct":-1}}`, "threshold_pct must be positive"},
+		{`{"volatility_spike":{"threshold":0}}`, "threshold must be positive"},
+		{`{"robust_zscore":{"window":-1}}`, "window must be positive"},
+		{`{"robust_zscore":{"sensitivity":0}}`, "sensitivity must be positive"},
+		{`{"robust_zscore":{"min_samples":500}}`, "min_samples must be between 1 and window"},
+		{`{"volume_spike":{"bucket_minutes":0}}`, "bucket_minutes must be between 1 and 1440"},
+		{`{"volume_spike":{"min_bucket_samples":-5}}`, "min_bucket_samples must be positive"},
+		{`{"gap":{"lookback":-1}}`, "lookback must be positive"},
+		{`{"gap":{"min_samples":0}}`, "min_samples must be between 1 and lookback"},
+		{`{"isolation_forest":{"contamination":0.5}}`, "contamination must be between 0 and 0.5"},
+		{`{"isolation_forest":{"trees":0}}`, "trees must be positive"},
+		{`{"isolation_forest":{"sample_size":1}}`, "sample_size must be at least 2"},
+		{`{"isolation_forest":{"window":-3}}`, "window must be positive"},
+		{`{"price_jump":{"threshold_pct":"x"}}`, "cannot unmarshal"},
+		{`{"bogus":{}}`, `unknown detector "bogus"`},
+		// One bad detector rejects the whole config
+		{`{"price_jump":{"threshold_pct":9},"volatility_spike":{"threshold":-2}}`, "detector volatility_spike"},
+	}
+	for _, tt := range tests {
+		err := r.Configure([]byte(tt.config))
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Configure(%s) = %v, want an error containing %q", tt.config, err, tt.want)
+		}
+		if jump.ThresholdPct != 5 || spike.Threshold != spikeThreshold || zscore.Window != 200 {
+			t.Errorf("Configure(%s) changed thresholds to %v, %v", tt.config, jump.ThresholdPct, spike.Threshold)
+		}
+	}
+}
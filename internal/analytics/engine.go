@@ -3,68 +3,130 @@ package analytics
 import (
 	"math"
 	"sync"
+	"time"
 )
 
 type RollingMetrics struct {
-	Symbol       string
-	VWAP         float64
-	Volatility   float64
-	PriceChange  float64
-	VolumeChange float64
+	Symbol              string
+	VWAP                float64
+	Volatility          float64
+	VolatilityEstimator VolatilityEstimator `json:"estimator"` // which estimate Volatility holds
+	VolatilityEstimates VolatilityEstimates
+	PriceChange         float64
+	VolumeChange        float64
+	Relative            *RelativeMetrics // nil until enough returns line up with the benchmark
+}
+
+// Tick is a single quote observation. Open, High and Low are the session
+// values reported alongside the price.
+type Tick struct {
+	Price  float64
+	Volume float64
+	Open   float64
+	High   float64
+	Low    float64
+	Time   time.Time
 }
 
 type Engine struct {
-	buffers map[string]*ringBuffer
-	mu      sync.Mutex
-	window  int
+	buffers   map[string]*ringBuffer
+	mu        sync.Mutex
+	window    int
+	estimator VolatilityEstimator
 }
 
 type ringBuffer struct {
+	mu      sync.Mutex
 	prices  []float64
 	volumes []float64
+	times   []time.Time
 	pos     int
 	size    int
 	full    bool
+	last    Tick
+	ewmaVar float64
+	ewmaN   int
 }
 
-func NewEngine(window int) *Engine {
+func NewEngine(window int, estimator VolatilityEstimator) *Engine {
 	return &Engine{
-		buffers: make(map[string]*ringBuffer),
-		window:  window,
+		buffers:   make(map[string]*ringBuffer),
+		window:    window,
+		estimator: estimator,
+	}
+}
+
+func newRingBuffer(size int) *ringBuffer {
+	return &ringBuffer{
+		prices:  make([]float64, size),
+		volumes: make([]float64, size),
+		times:   make([]time.Time, size),
+		size:    size,
 	}
 }
 
-func (e *Engine) Process(symbol string, price float64, volume float64) RollingMetrics {
+func (e *Engine) Process(symbol string, tick Tick) RollingMetrics {
 	e.mu.Lock()
 	rb, ok := e.buffers[symbol]
 	if !ok {
-		rb = &ringBuffer{
-			prices:  make([]float64, e.window),
-			volumes: make([]float64, e.window),
-			size:    e.window,
-		}
+		rb = newRingBuffer(e.window)
 		e.buffers[symbol] = rb
 	}
 	e.mu.Unlock()
 
-	rb.add(price, volume)
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+
+	rb.add(tick)
 
 	metrics := RollingMetrics{
-		Symbol: symbol,
-		VWAP:   rb.computeVWAP(),
+		Symbol:              symbol,
+		VWAP:                rb.computeVWAP(),
+		VolatilityEstimator: e.estimator,
 	}
 
 	if rb.full || rb.pos > 1 {
-		metrics.Volatility = rb.computeVolatility()
+		metrics.VolatilityEstimates = rb.computeVolatilityEstimates()
+		metrics.Volatility = metrics.VolatilityEstimates.Get(e.estimator)
 		metrics.PriceChange = rb.computeChange()
+		metrics.VolumeChange = rb.computeVolumeChange()
 	}
 
 	return metrics
 }
 
-func (rb *ringBuffer) add(p, v float64) {
-	rb.prices[rb.pos] = p
-	rb.volumes[rb.pos] = v
+// Has reports whether the engine holds any state for symbol.
+func (e *Engine) Has(symbol string) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	_, ok := e.buffers[symbol]
+	return ok
+}
+
+// Series returns the symbol's rolling window, oldest first, along with the
+// number of such sampling intervals in a trading year.
+func (e *Engine) Series(symbol string) ([]float64, []time.Time, float64, bool) {
+	e.mu.Lock()
+	rb, ok := e.buffers[symbol]
+	e.mu.Unlock()
+	if !ok {
+		return nil, nil, 0, false
+	}
+
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+	factor := rb.annualizationFactor()
+	return rb.ordered(rb.prices), rb.orderedTimes(), factor * factor, true
+}
+
+func (rb *ringBuffer) add(t Tick) {
+	if rb.full || rb.pos > 0 {
+		rb.updateEWMA(t.Price)
+	}
+	rb.prices[rb.pos] = t.Price
+	rb.volumes[rb.pos] = t.Volume
+	rb.times[rb.pos] = t.Time
+	rb.last = t
 	rb.pos = (rb.pos + 1) % rb.size
 	if rb.pos == 0 {
 		rb.full = true
@@ -117,3 +179,17 @@ func (rb *ringBuffer) computeChange() float64 {
 	first := rb.prices[(rb.pos-count+rb.size)%rb.size]
 	return ((last - first) / first) * 100
 }
+
+// computeVolumeChange compares the latest interval volume with the average
+// of the earlier intervals in the window, in percent.
+func (rb *ringBuffer) computeVolumeChange() float64 {
+	volumes := rb.ordered(rb.volumes)
+	if len(volumes) < 2 {
+		return 0
+	}
+	avg := mean(volumes[:len(volumes)-1])
+	if avg == 0 {
+		return 0
+	}
+	return (volumes[len(volumes)-1] - avg) / avg * 100
+}
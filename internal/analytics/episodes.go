@@ -0,0 +1,155 @@
+package analytics
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+type Severity string
+
+const (
+	SeverityInfo     Severity = "info"
+	SeverityWarning  Severity = "warning"
+	SeverityCritical Severity = "critical"
+)
+
+// Episode statuses carried on published anomalies.
+const (
+	StatusOpen      = "open"
+	StatusEscalated = "escalated"
+	StatusOngoing   = "ongoing"
+	StatusResolved  = "resolved"
+)
+
+func SeverityFor(confidence float64) Severity {
+	switch {
+	case confidence >= 0.95:
+		return SeverityCritical
+	case confidence >= 0.8:
+		return SeverityWarning
+	}
+	return SeverityInfo
+}
+
+func (s Severity) rank() int {
+	switch s {
+	case SeverityCritical:
+		return 2
+	case SeverityWarning:
+		return 1
+	}
+	return 0
+}
+
+// EpisodeTracker groups repeated findings for the same symbol and anomaly
+// type into one episode. An episode is published when it opens, when it
+// escalates, and again as a reminder once Cooldown has passed while it keeps
+// firing. It resolves after ResolveAfter without findings.
+type EpisodeTracker struct {
+	Cooldown     time.Duration
+	ResolveAfter time.Duration
+	// EscalationStep is the relative growth in magnitude over the episode's
+	// peak that counts as an escalation.
+	EscalationStep float64
+
+	episodes map[string]*episode
+	mu       sync.Mutex
+}
+
+type episode struct {
+	anomaly       Anomaly
+	lastSeen      time.Time
+	lastPublished time.Time
+	peakMagnitude float64
+}
+
+func NewEpisodeTracker(cooldown, resolveAfter time.Duration, escalationStep float64) *EpisodeTracker {
+	return &EpisodeTracker{
+		Cooldown:       cooldown,
+		ResolveAfter:   resolveAfter,
+		EscalationStep: escalationStep,
+		episodes:       make(map[string]*episode),
+	}
+}
+
+// Observe folds a finding into its episode and returns the event to publish,
+// or nil if it is suppressed.
+func (t *EpisodeTracker) Observe(a Anomaly, now time.Time) *Anomaly {
+	if a.Severity == "" {
+		a.Severity = SeverityFor(a.Confidence)
+	}
+	key := a.Symbol + "|" + a.Type
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	ep, ok := t.episodes[key]
+	if !ok {
+		a.EpisodeID = newEpisodeID()
+		a.StartedAt = now
+		a.Status = StatusOpen
+		t.episodes[key] = &episode{anomaly: a, lastSeen: now, lastPublished: now, peakMagnitude: a.Magnitude}
+		return &a
+	}
+
+	ep.lastSeen = now
+	a.EpisodeID = ep.anomaly.EpisodeID
+	a.StartedAt = ep.anomaly.StartedAt
+
+	escalated := a.Severity.rank() > ep.anomaly.Severity.rank() ||
+		(ep.peakMagnitude > 0 && a.Magnitude >= ep.peakMagnitude*(1+t.EscalationStep))
+	if a.Magnitude > ep.peakMagnitude {
+		ep.peakMagnitude = a.Magnitude
+	}
+	switch {
+	case escalated:
+		a.Status = StatusEscalated
+	case now.Sub(ep.lastPublished) >= t.Cooldown:
+		a.Status = StatusOngoing
+	default:
+		return nil
+	}
+	// Severity never drops while an episode is open
+	if a.Severity.rank() < ep.anomaly.Severity.rank() {
+		a.Severity = ep.anomaly.Severity
+	}
+	ep.anomaly = a
+	ep.lastPublished = now
+	return &a
+}
+
+// Sweep resolves every episode that has not fired for ResolveAfter and
+// returns a resolved event for each.
+func (t *EpisodeTracker) Sweep(now time.Time) []Anomaly {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var resolved []Anomaly
+	for key, ep := range t.episodes {
+		if now.Sub(ep.lastSeen) < t.ResolveAfter {
+			continue
+		}
+		a := ep.anomaly
+		a.Status = StatusResolved
+		a.Severity = SeverityInfo
+		a.Details = "Conditions have returned to normal."
+		ended := now
+		a.EndedAt = &ended
+		resolved = append(resolved, a)
+		delete(t.episodes, key)
+	}
+	return resolved
+}
+
+// NewAnomalyID returns a stable identifier for a published anomaly event.
+func NewAnomalyID() string {
+	return newEpisodeID()
+}
+
+func newEpisodeID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,170 @@
+package analytics
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Feedback labels users can attach to a published anomaly.
+const (
+	LabelUseful = "useful"
+	LabelNoise  = "noise"
+)
+
+func ValidLabel(label string) error {
+	if label != LabelUseful && label != LabelNoise {
+		return fmt.Errorf("label must be %q or %q", LabelUseful, LabelNoise)
+	}
+	return nil
+}
+
+// Precision is the share of labelled anomalies from one detector on one
+// symbol that users marked useful.
+type Precision struct {
+	Detector        string     `json:"detector"`
+	Symbol          string     `json:"symbol"`
+	Useful          int        `json:"useful"`
+	Noise           int        `json:"noise"`
+	Precision       float64    `json:"precision"`
+	Suppressed      bool       `json:"suppressed"`
+	SuppressedUntil *time.Time `json:"suppressed_until,omitempty"`
+}
+
+// FeedbackTracker keeps label counts per detector and symbol. When
+// SuppressBelow is positive, a detector whose precision on a symbol falls
+// below it after at least MinLabels labels is suppressed for that symbol for
+// SuppressFor. Once that expires its anomalies are published again, so users
+// can label them; the next noise label while precision is still too low
+// suppresses it again.
+type FeedbackTracker struct {
+	MinLabels     int
+	SuppressBelow float64
+	SuppressFor   time.Duration
+
+	counts map[[2]string]*Precision
+	mu     sync.RWMutex
+}
+
+func NewFeedbackTracker(minLabels int, suppressBelow float64) *FeedbackTracker {
+	return &FeedbackTracker{
+		MinLabels:     minLabels,
+		SuppressBelow: suppressBelow,
+		SuppressFor:   24 * time.Hour,
+		counts:        make(map[[2]string]*Precision),
+	}
+}
+
+// Record applies a label, replacing previous if the anomaly was already
+// labelled, and returns the updated precision.
+func (f *FeedbackTracker) Record(detector, symbol, label, previous string) Precision {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	p := f.entry(detector, symbol)
+	switch previous {
+	case LabelUseful:
+		p.Useful--
+	case LabelNoise:
+		p.Noise--
+	}
+	var start time.Time
+	if label == LabelNoise {
+		start = time.Now()
+	}
+	f.add(p, label, 1, start)
+	return *p
+}
+
+// Load adds stored label counts, typically at startup. last is when the
+// most recent of them was applied; stored noise labels only restore a
+// suppression that would still be running had it started then.
+func (f *FeedbackTracker) Load(detector, symbol, label string, n int, last time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var start time.Time
+	if label == LabelNoise {
+		start = last
+	}
+	f.add(f.entry(detector, symbol), label, n, start)
+}
+
+func (f *FeedbackTracker) Precisions() []Precision {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	out := make([]Precision, 0, len(f.counts))
+	now := time.Now()
+	for _, p := range f.counts {
+		c := *p
+		if c.SuppressedUntil != nil && !now.Before(*c.SuppressedUntil) {
+			c.Suppressed, c.SuppressedUntil = false, nil
+		}
+		out = append(out, c)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Detector != out[j].Detector {
+			return out[i].Detector < out[j].Detector
+		}
+		return out[i].Symbol < out[j].Symbol
+	})
+	return out
+}
+
+func (f *FeedbackTracker) Suppressed(detector, symbol string) bool {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	p, ok := f.counts[[2]string{detector, symbol}]
+	return ok && p.Suppressed && time.Now().Before(*p.SuppressedUntil)
+}
+
+// Unsuppress lifts a suppression early. It returns false if the detector was
+// not suppressed for symbol.
+func (f *FeedbackTracker) Unsuppress(detector, symbol string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	p, ok := f.counts[[2]string{detector, symbol}]
+	if !ok || !p.Suppressed {
+		return false
+	}
+	p.Suppressed, p.SuppressedUntil = false, nil
+	return true
+}
+
+func (f *FeedbackTracker) entry(detector, symbol string) *Precision {
+	key := [2]string{detector, symbol}
+	p, ok := f.counts[key]
+	if !ok {
+		p = &Precision{Detector: detector, Symbol: symbol}
+		f.counts[key] = p
+	}
+	return p
+}
+
+// add applies n labels. A detector that is not currently suppressed only
+// becomes suppressed if start is set, in which case the suppression runs for
+// SuppressFor from start.
+func (f *FeedbackTracker) add(p *Precision, label string, n int, start time.Time) {
+	switch label {
+	case LabelUseful:
+		p.Useful += n
+	case LabelNoise:
+		p.Noise += n
+	}
+	total := p.Useful + p.Noise
+	p.Precision = 0
+	if total > 0 {
+		p.Precision = float64(p.Useful) / float64(total)
+	}
+
+	now := time.Now()
+	active := p.Suppressed && now.Before(*p.SuppressedUntil)
+	switch {
+	case f.SuppressBelow <= 0 || total < f.MinLabels || p.Precision >= f.SuppressBelow:
+		p.Suppressed, p.SuppressedUntil = false, nil
+	case !active && !start.IsZero() && now.Before(start.Add(f.SuppressFor)):
+		until := start.Add(f.SuppressFor)
+		p.Suppressed, p.SuppressedUntil = true, &until
+	case !active:
+		p.Suppressed, p.SuppressedUntil = false, nil
+	}
+}
@@ -0,0 +1,62 @@
+package analytics
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFeedbackLoadOnlyRestoresRecentSuppression(t *testing.T) {
+	now := time.Now()
+	f := NewFeedbackTracker(5, 0.5)
+	f.SuppressFor = time.Hour
+
+	// Noise labels from before the suppression window don't mute anything
+	f.Load("price_jump", "AAPL", LabelNoise, 8, now.Add(-2*time.Hour))
+	f.Load("price_jump", "AAPL", LabelUseful, 1, now.Add(-3*time.Hour))
+	if f.Suppressed("price_jump", "AAPL") {
+		t.Error("labels older than SuppressFor suppressed the detector")
+	}
+
+	// Recent ones resume the suppression from the latest label
+	last := now.Add(-20 * time.Minute)
+	f.Load("volume_spike", "AAPL", LabelNoise, 8, last)
+	if !f.Suppressed("volume_spike", "AAPL") {
+		t.Fatal("recent noise labels did not restore the suppression")
+	}
+	for _, p := range f.Precisions() {
+		if p.Detector == "volume_spike" && !p.SuppressedUntil.Equal(last.Add(time.Hour)) {
+			t.Errorf("suppressed until %v, want %v", p.SuppressedUntil, last.Add(time.Hour))
+		}
+	}
+
+	// Enough useful labels lift it regardless of order
+	f.Load("volume_spike", "AAPL", LabelUseful, 10, now.Add(-time.Hour))
+	if f.Suppressed("volume_spike", "AAPL") {
+		t.Error("still suppressed with precision above the threshold")
+	}
+}
+
+func TestFeedbackRecordAndUnsuppress(t *testing.T) {
+	f := NewFeedbackTracker(3, 0.5)
+	for i := 0; i < 2; i++ {
+		f.Record("gap", "MSFT", LabelNoise, "")
+	}
+	if f.Suppressed("gap", "MSFT") {
+		t.Fatal("suppressed before MinLabels")
+	}
+	p := f.Record("gap", "MSFT", LabelNoise, "")
+	if !p.Suppressed || !f.Suppressed("gap", "MSFT") {
+		t.Fatal("not suppressed after three noise labels")
+	}
+	if !f.Unsuppress("gap", "MSFT") || f.Suppressed("gap", "MSFT") {
+		t.Error("Unsuppress did not lift the suppression")
+	}
+	if f.Unsuppress("gap", "MSFT") {
+		t.Error("Unsuppress reported a lift twice")
+	}
+	// Relabelling useful replaces the earlier noise label
+	p = f.Record("gap", "MSFT", LabelUseful, LabelNoise)
+	if p.Useful != 1 || p.Noise != 2 {
+		t.Errorf("counts = %d useful, %d noise, want 1, 2", p.Useful, p.Noise)
+	}
+}
@@ -0,0 +1,403 @@
+package analytics
+
+import (
+	"fmt"
+	"math"
+)
+
+const (
+	ModelHoltWinters = "holt_winters"
+	ModelAR          = "ar"
+
+	backtestFolds = 10
+	maxAROrder    = 5 // highest order tried when choosing by AIC
+
+	// Limits on caller-supplied options; forecasts and backtest folds
+	// allocate per horizon step.
+	MaxForecastHorizon = 250
+	MaxForecastSeason  = 260
+	MaxForecastOrder   = 20
+)
+
+type ForecastPoint struct {
+	Step  int     `json:"step"`
+	Value float64 `json:"value"`
+	Lower float64 `json:"lower"`
+	Upper float64 `json:"upper"`
+}
+
+// ForecastAccuracy is measured by refitting the model at earlier origins and
+// comparing its forecasts with what actually happened. Coverage is the share
+// of actuals that fell inside the prediction interval.
+type ForecastAccuracy struct {
+	Folds    int     `json:"folds"`
+	MAE      float64 `json:"mae"`
+	RMSE     float64 `json:"rmse"`
+	MAPE     float64 `json:"mape"`
+	Coverage float64 `json:"coverage"`
+}
+
+type Forecast struct {
+	Model      string             `json:"model"`
+	Horizon    int                `json:"horizon"`
+	Confidence float64            `json:"confidence"`
+	Params     map[string]float64 `json:"params"`
+	Points     []ForecastPoint    `json:"points"`
+	Backtest   *ForecastAccuracy  `json:"backtest"` // nil when the series is too short to backtest
+}
+
+// ForecastOptions selects the model. Season is the Holt-Winters seasonal
+// period (0 for trend only) and Order the AR order (0 to choose by AIC).
+type ForecastOptions struct {
+	Model      string
+	Horizon    int
+	Confidence float64
+	Season     int
+	Order      int
+}
+
+type fittedModel interface {
+	forecast(horizon int, z float64) []ForecastPoint
+	params() map[string]float64
+}
+
+func ForecastSeries(series []float64, opts ForecastOptions) (Forecast, error) {
+	if opts.Horizon < 1 || opts.Horizon > MaxForecastHorizon {
+		return Forecast{}, fmt.Errorf("horizon must be between 1 and %d", MaxForecastHorizon)
+	}
+	if opts.Season < 0 || opts.Season > MaxForecastSeason {
+		return Forecast{}, fmt.Errorf("season must be between 0 and %d", MaxForecastSeason)
+	}
+	if opts.Order < 0 || opts.Order > MaxForecastOrder {
+		return Forecast{}, fmt.Errorf("order must be between 0 and %d", MaxForecastOrder)
+	}
+	if opts.Confidence <= 0 || opts.Confidence >= 1 {
+		return Forecast{}, fmt.Errorf("confidence must be between 0 and 1")
+	}
+	minLen := minFitLength(opts)
+	if len(series) < minLen {
+		return Forecast{}, fmt.Errorf("need at least %d observations, have %d", minLen, len(series))
+	}
+
+	model, err := fitModel(series, opts)
+	if err != nil {
+		return Forecast{}, err
+	}
+	z := normInv(0.5 + opts.Confidence/2)
+	f := Forecast{
+		Model:      opts.Model,
+		Horizon:    opts.Horizon,
+		Confidence: opts.Confidence,
+		Params:     model.params(),
+		Points:     model.forecast(opts.Horizon, z),
+	}
+	f.Backtest = backtest(series, opts, z)
+	return f, nil
+}
+
+func minFitLength(opts ForecastOptions) int {
+	if opts.Model == ModelHoltWinters && opts.Season > 1 {
+		return 2*opts.Season + 2
+	}
+	return 2*maxAROrder + 2
+}
+
+func fitModel(series []float64, opts ForecastOptions) (fittedModel, error) {
+	switch opts.Model {
+	case ModelHoltWinters:
+		return fitHoltWinters(series, opts.Season), nil
+	case ModelAR:
+		return fitARI(series, opts.Order)
+	}
+	return nil, fmt.Errorf("unknown model %q", opts.Model)
+}
+
+// backtest refits the model at backtestFolds earlier origins and scores the
+// resulting out-of-sample forecasts.
+func backtest(series []float64, opts ForecastOptions, z float64) *ForecastAccuracy {
+	minLen := minFitLength(opts)
+	folds := backtestFolds
+	if avail := len(series) - opts.Horizon - minLen + 1; avail < folds {
+		folds = avail
+	}
+	if folds < 1 {
+		return nil
+	}
+
+	acc := &ForecastAccuracy{Folds: folds}
+	var n, covered, mapeN int
+	for k := 0; k < folds; k++ {
+		origin := len(series) - opts.Horizon - k
+		model, err := fitModel(series[:origin], opts)
+		if err != nil {
+			continue
+		}
+		for _, p := range model.forecast(opts.Horizon, z) {
+			actual := series[origin+p.Step-1]
+			e := actual - p.Value
+			acc.MAE += math.Abs(e)
+			acc.RMSE += e * e
+			if actual != 0 {
+				acc.MAPE += math.Abs(e / actual)
+				mapeN++
+			}
+			if actual >= p.Lower && actual <= p.Upper {
+				covered++
+			}
+			n++
+		}
+	}
+	if n == 0 {
+		return nil
+	}
+	acc.MAE /= float64(n)
+	acc.RMSE = math.Sqrt(acc.RMSE / float64(n))
+	if mapeN > 0 {
+		acc.MAPE = 100 * acc.MAPE / float64(mapeN)
+	}
+	acc.Coverage = float64(covered) / float64(n)
+	return acc
+}
+
+// holtWinters is additive exponential smoothing with an optional seasonal
+// component. Smoothing parameters are chosen by grid search on one-step SSE.
+type holtWinters struct {
+	alpha, beta, gamma float64
+	season             int
+	n                  int
+	level, trend       float64
+	seasonal           []float64
+	sigma2             float64
+}
+
+func fitHoltWinters(y []float64, season int) *holtWinters {
+	if season < 2 {
+		season = 0
+	}
+	grid := []float64{0.1, 0.2, 0.3, 0.4, 0.5, 0.6, 0.7, 0.8, 0.9}
+	gammas := grid
+	if season == 0 {
+		gammas = []float64{0}
+	}
+
+	var best *holtWinters
+	bestSSE := math.Inf(1)
+	for _, a := range grid {
+		for _, b := range grid {
+			for _, g := range gammas {
+				hw, sse := runHoltWinters(y, season, a, b, g)
+				if sse < bestSSE {
+					best, bestSSE = hw, sse
+				}
+			}
+		}
+	}
+	return best
+}
+
+func runHoltWinters(y []float64, season int, alpha, beta, gamma float64) (*holtWinters, float64) {
+	hw := &holtWinters{alpha: alpha, beta: beta, gamma: gamma, season: season, n: len(y)}
+	start := 1
+	if season > 0 {
+		first, second := mean(y[:season]), mean(y[season:2*season])
+		hw.level = first
+		hw.trend = (second - first) / float64(season)
+		hw.seasonal = make([]float64, season)
+		for i := 0; i < season; i++ {
+			hw.seasonal[i] = y[i] - first
+		}
+		start = season
+	} else {
+		hw.level = y[0]
+		hw.trend = y[1] - y[0]
+	}
+
+	var sse float64
+	var count int
+	for t := start; t < len(y); t++ {
+		s := 0.0
+		if season > 0 {
+			s = hw.seasonal[t%season]
+		}
+		e := y[t] - (hw.level + hw.trend + s)
+		sse += e * e
+		count++
+
+		prevLevel := hw.level
+		hw.level = alpha*(y[t]-s) + (1-alpha)*(hw.level+hw.trend)
+		hw.trend = beta*(hw.level-prevLevel) + (1-beta)*hw.trend
+		if season > 0 {
+			hw.seasonal[t%season] = gamma*(y[t]-hw.level) + (1-gamma)*s
+		}
+	}
+	if count > 0 {
+		hw.sigma2 = sse / float64(count)
+	}
+	return hw, sse
+}
+
+func (hw *holtWinters) forecast(horizon int, z float64) []ForecastPoint {
+	points := make([]ForecastPoint, horizon)
+	var cum float64
+	for h := 1; h <= horizon; h++ {
+		v := hw.level + float64(h)*hw.trend
+		if hw.season > 0 {
+			v += hw.seasonal[(hw.n-1+h)%hw.season]
+		}
+		// Variance of the h-step error for additive trend smoothing
+		if h > 1 {
+			c := hw.alpha * (1 + float64(h-1)*hw.beta)
+			cum += c * c
+		}
+		width := z * math.Sqrt(hw.sigma2*(1+cum))
+		points[h-1] = ForecastPoint{Step: h, Value: v, Lower: v - width, Upper: v + width}
+	}
+	return points
+}
+
+func (hw *holtWinters) params() map[string]float64 {
+	return map[string]float64{
+		"alpha":  hw.alpha,
+		"beta":   hw.beta,
+		"gamma":  hw.gamma,
+		"season": float64(hw.season),
+		"sigma":  math.Sqrt(hw.sigma2),
+	}
+}
+
+// arModel is an AR(p) model fitted by Yule-Walker on first differences, so
+// forecasts are integrated back to price levels (ARIMA(p,1,0)).
+type arModel struct {
+	phi    []float64
+	mu     float64
+	sigma2 float64
+	last   float64
+	diffs  []float64
+	aic    float64
+}
+
+func fitARI(series []float64, order int) (*arModel, error) {
+	diffs := make([]float64, len(series)-1)
+	for i := 1; i < len(series); i++ {
+		diffs[i-1] = series[i] - series[i-1]
+	}
+
+	if order > 0 {
+		if len(diffs) <= 2*order {
+			return nil, fmt.Errorf("need more than %d observations for AR(%d)", 2*order+1, order)
+		}
+		m := fitAR(diffs, order)
+		m.last = series[len(series)-1]
+		return m, nil
+	}
+
+	var best *arModel
+	for p := 1; p <= maxAROrder && len(diffs) > 2*p; p++ {
+		m := fitAR(diffs, p)
+		if best == nil || m.aic < best.aic {
+			best = m
+		}
+	}
+	if best == nil {
+		return nil, fmt.Errorf("series too short for an AR model")
+	}
+	best.last = series[len(series)-1]
+	return best, nil
+}
+
+func fitAR(x []float64, p int) *arModel {
+	mu := mean(x)
+	n := len(x)
+	acov := make([]float64, p+1)
+	for k := 0; k <= p; k++ {
+		for t := k; t < n; t++ {
+			acov[k] += (x[t] - mu) * (x[t-k] - mu)
+		}
+		acov[k] /= float64(n)
+	}
+
+	phi := levinsonDurbin(acov, p)
+
+	var sse float64
+	for t := p; t < n; t++ {
+		pred := mu
+		for j := 0; j < p; j++ {
+			pred += phi[j] * (x[t-1-j] - mu)
+		}
+		e := x[t] - pred
+		sse += e * e
+	}
+	sigma2 := sse / float64(n-p)
+	aic := math.Inf(1)
+	if sigma2 > 0 {
+		aic = float64(n-p)*math.Log(sigma2) + 2*float64(p+1)
+	}
+	return &arModel{phi: phi, mu: mu, sigma2: sigma2, diffs: x, aic: aic}
+}
+
+func levinsonDurbin(r []float64, p int) []float64 {
+	phi := make([]float64, p)
+	if r[0] == 0 {
+		return phi
+	}
+	prev := make([]float64, p)
+	e := r[0]
+	for k := 1; k <= p; k++ {
+		acc := r[k]
+		for j := 1; j < k; j++ {
+			acc -= prev[j-1] * r[k-j]
+		}
+		ref := acc / e
+		phi[k-1] = ref
+		for j := 1; j < k; j++ {
+			phi[j-1] = prev[j-1] - ref*prev[k-j-1]
+		}
+		e *= 1 - ref*ref
+		copy(prev, phi)
+	}
+	return phi
+}
+
+func (m *arModel) forecast(horizon int, z float64) []ForecastPoint {
+	p := len(m.phi)
+	history := append([]float64(nil), m.diffs[len(m.diffs)-p:]...)
+
+	// psi weights of the differenced process, cumulated for the level
+	psi := make([]float64, horizon)
+	psi[0] = 1
+	for j := 1; j < horizon; j++ {
+		for k := 1; k <= p && k <= j; k++ {
+			psi[j] += m.phi[k-1] * psi[j-k]
+		}
+	}
+
+	points := make([]ForecastPoint, horizon)
+	level := m.last
+	var cumPsi, variance float64
+	for h := 1; h <= horizon; h++ {
+		d := m.mu
+		for j := 0; j < p; j++ {
+			d += m.phi[j] * (history[len(history)-1-j] - m.mu)
+		}
+		history = append(history, d)
+		level += d
+
+		cumPsi += psi[h-1]
+		variance += cumPsi * cumPsi
+		width := z * math.Sqrt(m.sigma2*variance)
+		points[h-1] = ForecastPoint{Step: h, Value: level, Lower: level - width, Upper: level + width}
+	}
+	return points
+}
+
+func (m *arModel) params() map[string]float64 {
+	params := map[string]float64{
+		"order": float64(len(m.phi)),
+		"drift": m.mu,
+		"sigma": math.Sqrt(m.sigma2),
+	}
+	for i, phi := range m.phi {
+		params[fmt.Sprintf("phi%d", i+1)] = phi
+	}
+	return params
+}
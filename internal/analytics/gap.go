@@ -0,0 +1,272 @@
+package analytics
+
+import (
+	"fmt"
+	"math"
+	"sync"
+)
+
+// Gap describes the session's opening gap and how much of it has been filled.
+// FillPct is the share of the distance between the open and the previous
+// close that the session has since traded back through.
+type Gap struct {
+	Symbol        string  `json:"symbol"`
+	TradingDay    string  `json:"trading_day"`
+	PreviousClose float64 `json:"previous_close"`
+	Open          float64 `json:"open"`
+	GapPct        float64 `json:"gap_pct"`
+	Direction     string  `json:"direction"`   // "up" or "down"
+	TypicalPct    float64 `json:"typical_pct"` // median absolute gap, 0 until there is enough history
+	Significant   bool    `json:"significant"`
+	FillPct       float64 `json:"fill_pct"`
+	Filled        bool    `json:"filled"`
+}
+
+// GapDetector flags opening gaps that are large compared with the symbol's
+// typical overnight gap, reports when a significant gap is filled, and flags
+// prices that have moved unusually far from the previous close.
+type GapDetector struct {
+	Threshold          float64 `json:"threshold"`           // gap / typical gap
+	MinGapPct          float64 `json:"min_gap_pct"`         // gaps smaller than this are never significant
+	FallbackGapPct     float64 `json:"fallback_gap_pct"`    // used until MinSamples sessions are known
+	DeviationThreshold float64 `json:"deviation_threshold"` // day move / typical daily move
+	MinSamples         int     `json:"min_samples"`
+	Lookback           int     `json:"lookback"` // sessions of history kept
+
+	states map[string]*gapState
+	mu     sync.Mutex
+}
+
+type gapState struct {
+	gaps  []float64 // absolute opening gaps of past sessions, percent
+	moves []float64 // absolute close-to-close moves of past sessions, percent
+
+	day       string
+	prevClose float64
+	lastPrice float64
+	high, low float64
+	gap       *Gap
+}
+
+func NewGapDetector() *GapDetector {
+	return &GapDetector{
+		Threshold:          3,
+		MinGapPct:          0.5,
+		FallbackGapPct:     2,
+		DeviationThreshold: 3,
+		MinSamples:         5,
+		Lookback:           60,
+		states:             make(map[string]*gapState),
+	}
+}
+
+func (d *GapDetector) Name() string { return "gap" }
+
+func (d *GapDetector) Validate() error {
+	switch {
+	case d.Threshold <= 0 || d.DeviationThreshold <= 0:
+		return fmt.Errorf("threshold and deviation_threshold must be positive")
+	case d.MinGapPct < 0 || d.FallbackGapPct <= 0:
+		return fmt.Errorf("min_gap_pct must not be negative and fallback_gap_pct must be positive")
+	case d.Lookback <= 0:
+		return fmt.Errorf("lookback must be positive")
+	case d.MinSamples <= 0 || d.MinSamples > d.Lookback:
+		return fmt.Errorf("min_samples must be between 1 and lookback")
+	}
+	return nil
+}
+
+func (d *GapDetector) Detect(obs Observation) []Anomaly {
+	t := obs.Tick
+	if t.Price <= 0 || obs.TradingDay == "" {
+		return nil
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	st := d.state(obs.Symbol)
+	if obs.TradingDay != st.day {
+		d.closeSession(st)
+		st.day = obs.TradingDay
+		st.gap = nil
+		st.high, st.low = 0, 0
+	}
+	st.lastPrice = t.Price
+	if obs.PreviousClose > 0 {
+		st.prevClose = obs.PreviousClose
+	}
+	st.track(t)
+
+	var anomalies []Anomaly
+	if st.gap == nil && t.Open > 0 && st.prevClose > 0 {
+		st.gap = d.openGap(obs.Symbol, st, t.Open)
+		if st.gap.Significant {
+			anomalies = append(anomalies, Anomaly{
+				Symbol:     obs.Symbol,
+				Type:       "opening_gap",
+				Magnitude:  math.Abs(st.gap.GapPct),
+				Confidence: d.confidence(math.Abs(st.gap.GapPct), st.gaps),
+				Details:    fmt.Sprintf("Opened %.2f%% %s from the previous close of %.2f.", math.Abs(st.gap.GapPct), st.gap.Direction, st.prevClose),
+			})
+		}
+	}
+
+	if g := st.gap; g != nil && !g.Filled {
+		g.FillPct = st.fill(g)
+		if g.FillPct >= 100 {
+			g.Filled = true
+			if g.Significant {
+				anomalies = append(anomalies, Anomaly{
+					Symbol:     obs.Symbol,
+					Type:       "gap_filled",
+					Magnitude:  math.Abs(g.GapPct),
+					Confidence: d.confidence(math.Abs(g.GapPct), st.gaps),
+					Details:    fmt.Sprintf("The %.2f%% opening gap has been filled back to %.2f.", math.Abs(g.GapPct), g.PreviousClose),
+				})
+			}
+		}
+	}
+
+	if st.prevClose > 0 && len(st.moves) >= d.MinSamples {
+		move := (t.Price - st.prevClose) / st.prevClose * 100
+		if typical := median(st.moves); typical > 0 && math.Abs(move)/typical >= d.DeviationThreshold {
+			anomalies = append(anomalies, Anomaly{
+				Symbol:     obs.Symbol,
+				Type:       "close_deviation",
+				Magnitude:  math.Abs(move) / typical,
+				Confidence: d.confidence(math.Abs(move), st.moves),
+				Details:    fmt.Sprintf("Trading %.2f%% from the previous close, %.1fx the typical daily move.", move, math.Abs(move)/typical),
+			})
+		}
+	}
+	return anomalies
+}
+
+// Gap returns the current session's gap for symbol, if one has been seen.
+func (d *GapDetector) Gap(symbol string) (Gap, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	st, ok := d.states[symbol]
+	if !ok || st.gap == nil {
+		return Gap{}, false
+	}
+	return *st.gap, true
+}
+
+// Seed rebuilds gap and daily move history from historical ticks, oldest
+// first, using the first and last price of each session as its open and close.
+func (d *GapDetector) Seed(symbol string, history []Tick) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	st := d.state(symbol)
+	var prevClose, open, close float64
+	day := ""
+	for _, t := range history {
+		if t.Price <= 0 {
+			continue
+		}
+		tDay := t.Time.In(marketLocation).Format("2006-01-02")
+		if tDay != day {
+			if day != "" && prevClose > 0 {
+				st.gaps = appendCapped(st.gaps, math.Abs(open/prevClose-1)*100, d.Lookback)
+				st.moves = appendCapped(st.moves, math.Abs(close/prevClose-1)*100, d.Lookback)
+			}
+			if day != "" {
+				prevClose = close
+			}
+			day, open = tDay, t.Price
+		}
+		close = t.Price
+	}
+	// The last session may still be in progress, so it only seeds the state
+	if day != "" && st.day == "" {
+		st.day = day
+		st.prevClose = prevClose
+		st.lastPrice = close
+	}
+}
+
+func (d *GapDetector) state(symbol string) *gapState {
+	st, ok := d.states[symbol]
+	if !ok {
+		st = &gapState{}
+		d.states[symbol] = st
+	}
+	return st
+}
+
+// closeSession records the finished session's gap and close-to-close move.
+func (d *GapDetector) closeSession(st *gapState) {
+	if st.gap != nil {
+		st.gaps = appendCapped(st.gaps, math.Abs(st.gap.GapPct), d.Lookback)
+	}
+	if st.prevClose > 0 && st.lastPrice > 0 {
+		st.moves = appendCapped(st.moves, math.Abs(st.lastPrice/st.prevClose-1)*100, d.Lookback)
+	}
+}
+
+func (d *GapDetector) openGap(symbol string, st *gapState, open float64) *Gap {
+	g := &Gap{
+		Symbol:        symbol,
+		TradingDay:    st.day,
+		PreviousClose: st.prevClose,
+		Open:          open,
+		GapPct:        (open - st.prevClose) / st.prevClose * 100,
+		Direction:     "up",
+	}
+	if g.GapPct < 0 {
+		g.Direction = "down"
+	}
+	size := math.Abs(g.GapPct)
+	if len(st.gaps) >= d.MinSamples {
+		g.TypicalPct = median(st.gaps)
+		g.Significant = size >= d.MinGapPct && g.TypicalPct > 0 && size/g.TypicalPct >= d.Threshold
+	} else {
+		g.Significant = size >= d.FallbackGapPct
+	}
+	if g.GapPct == 0 {
+		g.Filled = true
+		g.FillPct = 100
+	}
+	return g
+}
+
+func (d *GapDetector) confidence(size float64, history []float64) float64 {
+	if len(history) < d.MinSamples {
+		return 0.5
+	}
+	if z, ok := robustZ(size, history); ok {
+		return tailConfidence(z)
+	}
+	return 0.5
+}
+
+// track keeps the session extremes, preferring the quote's own high and low.
+func (st *gapState) track(t Tick) {
+	high, low := t.High, t.Low
+	if high <= 0 {
+		high = t.Price
+	}
+	if low <= 0 {
+		low = t.Price
+	}
+	if high > st.high {
+		st.high = high
+	}
+	if st.low == 0 || low < st.low {
+		st.low = low
+	}
+}
+
+func (st *gapState) fill(g *Gap) float64 {
+	gap := g.Open - g.PreviousClose
+	var retraced float64
+	if gap > 0 {
+		retraced = g.Open - st.low
+	} else {
+		retraced = st.high - g.Open
+		gap = -gap
+	}
+	return math.Max(0, math.Min(100, retraced/gap*100))
+}
@@ -0,0 +1,309 @@
+package analytics
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// isolationFeatures names the columns of the feature vectors built for the
+// isolation forest, in order.
+var isolationFeatures = []string{"return", "volume_ratio", "volatility", "vwap_deviation", "price_change", "range"}
+
+// IsolationForestDetector scores each tick's feature vector with an
+// isolation forest trained on that symbol's recent ticks, catching unusual
+// combinations that no single-feature threshold would flag. The score
+// threshold is the training score quantile implied by Contamination.
+// Forests are trained in the background and swapped in when ready, unless
+// Synchronous is set; each training run is seeded from RandomSeed, so the
+// same data gives the same forest.
+type IsolationForestDetector struct {
+	Contamination float64 `json:"contamination"` // expected share of anomalous ticks
+	Trees         int     `json:"trees"`
+	SampleSize    int     `json:"sample_size"`   // points drawn to grow each tree
+	Window        int     `json:"window"`        // feature vectors kept per symbol for training
+	MinSamples    int     `json:"min_samples"`   // vectors needed before the first training
+	RetrainEvery  int     `json:"retrain_every"` // ticks between retrains
+	RandomSeed    int64   `json:"seed"`
+	// Synchronous trains on the calling goroutine so replays and tests are
+	// reproducible
+	Synchronous bool `json:"-"`
+
+	symbols map[string]*isolationState
+	mu      sync.Mutex
+}
+
+type isolationState struct {
+	vectors   [][]float64
+	lastPrice float64
+	forest    *isolationForest
+	sinceFit  int
+	training  bool
+	fits      int64 // completed or started trainings, varies the seed
+}
+
+type isolationForest struct {
+	trees      []*iNode
+	sampleSize int
+	threshold  float64
+	scores     []float64 // sorted training scores, for confidence
+}
+
+type iNode struct {
+	feature     int
+	split       float64
+	left, right *iNode
+	size        int // points reaching a leaf
+}
+
+func NewIsolationForestDetector() *IsolationForestDetector {
+	return &IsolationForestDetector{
+		Contamination: 0.01,
+		Trees:         100,
+		SampleSize:    256,
+		Window:        2000,
+		MinSamples:    200,
+		RetrainEvery:  500,
+		RandomSeed:    1,
+		symbols:       make(map[string]*isolationState),
+	}
+}
+
+func (d *IsolationForestDetector) Name() string { return "isolation_forest" }
+
+func (d *IsolationForestDetector) Validate() error {
+	switch {
+	case d.Contamination <= 0 || d.Contamination >= 0.5:
+		return fmt.Errorf("contamination must be between 0 and 0.5")
+	case d.Trees <= 0:
+		return fmt.Errorf("trees must be positive")
+	case d.SampleSize < 2:
+		return fmt.Errorf("sample_size must be at least 2")
+	case d.Window <= 0:
+		return fmt.Errorf("window must be positive")
+	case d.MinSamples < 2 || d.MinSamples > d.Window:
+		return fmt.Errorf("min_samples must be between 2 and window")
+	case d.RetrainEvery <= 0:
+		return fmt.Errorf("retrain_every must be positive")
+	}
+	return nil
+}
+
+func (d *IsolationForestDetector) Detect(obs Observation) []Anomaly {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	st, ok := d.symbols[obs.Symbol]
+	if !ok {
+		st = &isolationState{}
+		d.symbols[obs.Symbol] = st
+	}
+	x, ok := st.features(obs)
+	if !ok {
+		return nil
+	}
+
+	var anomalies []Anomaly
+	if st.forest != nil {
+		score := st.forest.score(x)
+		if score >= st.forest.threshold {
+			// Share of training points that scored lower
+			rank := sort.SearchFloat64s(st.forest.scores, score)
+			anomalies = append(anomalies, Anomaly{
+				Symbol:     obs.Symbol,
+				Type:       "multivariate_outlier",
+				Magnitude:  score,
+				Confidence: float64(rank) / float64(len(st.forest.scores)),
+				Details:    fmt.Sprintf("Unusual combination of features (isolation score %.2f): %s.", score, describeOutlier(x, st.vectors)),
+			})
+		}
+	}
+
+	st.vectors = append(st.vectors, x)
+	if len(st.vectors) > d.Window {
+		st.vectors = st.vectors[len(st.vectors)-d.Window:]
+	}
+	st.sinceFit++
+	if !st.training && len(st.vectors) >= d.MinSamples && (st.forest == nil || st.sinceFit >= d.RetrainEvery) {
+		st.training = true
+		st.sinceFit = 0
+		st.fits++
+		rng := rand.New(rand.NewSource(d.RandomSeed + st.fits))
+		if d.Synchronous {
+			st.forest = fitForest(st.vectors, rng, d.Trees, d.SampleSize, d.Contamination)
+			st.training = false
+			return anomalies
+		}
+		data := append([][]float64(nil), st.vectors...)
+		trees, sampleSize, contamination := d.Trees, d.SampleSize, d.Contamination
+		go func() {
+			forest := fitForest(data, rng, trees, sampleSize, contamination)
+			d.mu.Lock()
+			st.forest = forest
+			st.training = false
+			d.mu.Unlock()
+		}()
+	}
+	return anomalies
+}
+
+// features turns an observation into a vector of isolationFeatures.
+func (st *isolationState) features(obs Observation) ([]float64, bool) {
+	t, m := obs.Tick, obs.Metrics
+	prev := st.lastPrice
+	st.lastPrice = t.Price
+	if prev <= 0 || t.Price <= 0 || m.VWAP <= 0 {
+		return nil, false
+	}
+	rangePct := 0.0
+	if t.High > 0 && t.Low > 0 {
+		rangePct = (t.High - t.Low) / t.Price
+	}
+	return []float64{
+		math.Log(t.Price / prev),
+		math.Log1p(math.Max(m.VolumeChange/100, -0.99)),
+		m.Volatility,
+		(t.Price - m.VWAP) / m.VWAP,
+		m.PriceChange,
+		rangePct,
+	}, true
+}
+
+func fitForest(data [][]float64, rng *rand.Rand, trees, sampleSize int, contamination float64) *isolationForest {
+	if trees <= 0 {
+		trees = 100
+	}
+	if sampleSize < 2 {
+		sampleSize = 256
+	}
+	if sampleSize > len(data) {
+		sampleSize = len(data)
+	}
+	if contamination <= 0 || contamination >= 0.5 {
+		contamination = 0.01
+	}
+	maxDepth := int(math.Ceil(math.Log2(float64(sampleSize))))
+	f := &isolationForest{sampleSize: sampleSize}
+	for i := 0; i < trees; i++ {
+		sample := make([][]float64, sampleSize)
+		for j, k := range rng.Perm(len(data))[:sampleSize] {
+			sample[j] = data[k]
+		}
+		f.trees = append(f.trees, grow(rng, sample, 0, maxDepth))
+	}
+
+	f.scores = make([]float64, len(data))
+	for i, x := range data {
+		f.scores[i] = f.score(x)
+	}
+	sort.Float64s(f.scores)
+	f.threshold = quantile(f.scores, 1-contamination)
+	return f
+}
+
+func grow(rng *rand.Rand, data [][]float64, depth, maxDepth int) *iNode {
+	if depth >= maxDepth || len(data) <= 1 {
+		return &iNode{size: len(data)}
+	}
+	// Split on a random feature that still varies within this node
+	var candidates []int
+	lo := make([]float64, len(data[0]))
+	hi := make([]float64, len(data[0]))
+	for f := range lo {
+		lo[f], hi[f] = math.Inf(1), math.Inf(-1)
+		for _, x := range data {
+			lo[f] = math.Min(lo[f], x[f])
+			hi[f] = math.Max(hi[f], x[f])
+		}
+		if hi[f] > lo[f] {
+			candidates = append(candidates, f)
+		}
+	}
+	if len(candidates) == 0 {
+		return &iNode{size: len(data)}
+	}
+	f := candidates[rng.Intn(len(candidates))]
+	split := lo[f] + rng.Float64()*(hi[f]-lo[f])
+
+	var left, right [][]float64
+	for _, x := range data {
+		if x[f] < split {
+			left = append(left, x)
+		} else {
+			right = append(right, x)
+		}
+	}
+	return &iNode{
+		feature: f,
+		split:   split,
+		left:    grow(rng, left, depth+1, maxDepth),
+		right:   grow(rng, right, depth+1, maxDepth),
+	}
+}
+
+// score is the standard anomaly score 2^(-E[h(x)]/c(n)): close to 1 for
+// points isolated quickly, around 0.5 or below for ordinary points.
+func (f *isolationForest) score(x []float64) float64 {
+	var total float64
+	for _, t := range f.trees {
+		total += pathLength(x, t, 0)
+	}
+	return math.Pow(2, -(total/float64(len(f.trees)))/averagePathLength(f.sampleSize))
+}
+
+func pathLength(x []float64, n *iNode, depth int) float64 {
+	for n.left != nil {
+		if x[n.feature] < n.split {
+			n = n.left
+		} else {
+			n = n.right
+		}
+		depth++
+	}
+	return float64(depth) + averagePathLength(n.size)
+}
+
+// averagePathLength is the mean path length of an unsuccessful search in a
+// binary search tree of n points, used to normalise path lengths.
+func averagePathLength(n int) float64 {
+	if n <= 1 {
+		return 0
+	}
+	if n == 2 {
+		return 1
+	}
+	return 2*(math.Log(float64(n-1))+0.5772156649) - 2*float64(n-1)/float64(n)
+}
+
+// describeOutlier names the two features furthest from their usual values.
+func describeOutlier(x []float64, history [][]float64) string {
+	type dev struct {
+		name string
+		z    float64
+	}
+	devs := make([]dev, 0, len(x))
+	column := make([]float64, len(history))
+	for f := range x {
+		for i, v := range history {
+			column[i] = v[f]
+		}
+		if z, ok := robustZ(x[f], column); ok {
+			devs = append(devs, dev{isolationFeatures[f], z})
+		}
+	}
+	sort.Slice(devs, func(i, j int) bool { return math.Abs(devs[i].z) > math.Abs(devs[j].z) })
+	if len(devs) > 2 {
+		devs = devs[:2]
+	}
+	parts := make([]string, len(devs))
+	for i, d := range devs {
+		parts[i] = fmt.Sprintf("%s z=%.1f", d.name, d.z)
+	}
+	if len(parts) == 0 {
+		return "no single feature stands out"
+	}
+	return strings.Join(parts, ", ")
+}
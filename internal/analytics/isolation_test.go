@@ -0,0 +1,95 @@
+package analytics
+
+import (
+	"context"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+// isolationReplay feeds ordinary ticks followed by one with a large move on
+// a huge volume surge and returns every finding.
+func isolationReplay(d *IsolationForestDetector) []Anomaly {
+	rng := rand.New(rand.NewSource(7))
+	price := 100.0
+	var found []Anomaly
+	observe := func(ret, volumeChange float64) {
+		price *= 1 + ret
+		found = append(found, d.Detect(Observation{
+			Symbol: "AAPL",
+			Tick:   Tick{Price: price, High: price * 1.01, Low: price * 0.99},
+			Metrics: RollingMetrics{
+				VWAP:         100,
+				Volatility:   0.5 + 0.05*rng.Float64(),
+				PriceChange:  ret * 100,
+				VolumeChange: volumeChange,
+			},
+		})...)
+	}
+	for i := 0; i < 400; i++ {
+		observe(0.001*rng.NormFloat64(), 10*rng.NormFloat64())
+	}
+	observe(0.08, 5000)
+	return found
+}
+
+func TestIsolationForestSynchronous(t *testing.T) {
+	newDetector := func() *IsolationForestDetector {
+		d := NewIsolationForestDetector()
+		d.Synchronous = true
+		d.MinSamples, d.RetrainEvery = 100, 100
+		return d
+	}
+	first := isolationReplay(newDetector())
+	if len(first) == 0 || first[len(first)-1].Type != "multivariate_outlier" {
+		t.Fatalf("the final outlier was not flagged: %+v", first)
+	}
+	second := isolationReplay(newDetector())
+	if len(first) != len(second) {
+		t.Fatalf("replays flagged %d and %d ticks, want the same", len(first), len(second))
+	}
+	for i := range first {
+		if first[i].Magnitude != second[i].Magnitude {
+			t.Errorf("finding %d scored %v and %v, want the same", i, first[i].Magnitude, second[i].Magnitude)
+		}
+	}
+}
+
+func TestIsolationForestIsOptIn(t *testing.T) {
+	for _, s := range DefaultDetectors().Statuses() {
+		if s.Name == "isolation_forest" && s.Enabled {
+			t.Error("isolation_forest is enabled by default")
+		}
+	}
+}
+
+func TestBacktestIsReproducible(t *testing.T) {
+	rng := rand.New(rand.NewSource(3))
+	start := time.Date(2026, 10, 14, 14, 0, 0, 0, time.UTC)
+	price := 100.0
+	var ticks []Tick
+	for i := 0; i < 600; i++ {
+		price *= 1 + 0.002*rng.NormFloat64()
+		ticks = append(ticks, Tick{Price: price, Volume: 1000 + 200*rng.Float64(), Time: start.Add(time.Duration(i) * time.Minute)})
+	}
+	history := map[string][]Tick{"AAPL": ticks}
+
+	run := func() BacktestReport {
+		detectors := NewDetectorRegistry()
+		forest := NewIsolationForestDetector()
+		forest.Trees, forest.MinSamples, forest.RetrainEvery = 25, 100, 100
+		detectors.Register(forest, true)
+		report, err := Backtest(context.Background(), history, NewEngine(50, EstimatorLogReturn), detectors, nil, BacktestOptions{Cooldown: time.Minute, ResolveAfter: 5 * time.Minute})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return report
+	}
+	first, second := run(), run()
+	if first.Findings == 0 {
+		t.Fatal("the forest never scored a tick during the replay")
+	}
+	if first.Findings != second.Findings || first.Episodes != second.Episodes {
+		t.Errorf("replays found %d/%d and %d/%d findings/episodes, want the same", first.Findings, first.Episodes, second.Findings, second.Episodes)
+	}
+}
@@ -0,0 +1,231 @@
+package analytics
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Band states reported by the BandMonitor.
+const (
+	BandNormal  = "normal"
+	BandWarning = "warning"
+	BandBreach  = "breach"
+)
+
+// BandTier sets the band percentage for reference prices at or above
+// MinPrice. A non-zero MaxWidth caps the band width in price terms, as with
+// the lesser-of rule for sub-dollar securities.
+type BandTier struct {
+	MinPrice float64 `json:"min_price"`
+	Pct      float64 `json:"pct"`
+	MaxWidth float64 `json:"max_width,omitempty"`
+}
+
+// BandConfig configures the limit-up/limit-down monitor. Symbols overrides
+// the default tiers for individual symbols.
+type BandConfig struct {
+	Tiers                  []BandTier            `json:"tiers"`
+	Symbols                map[string][]BandTier `json:"symbols,omitempty"`
+	ReferenceWindowSeconds int                   `json:"reference_window_seconds"`
+	WarningUsage           float64               `json:"warning_usage"` // share of the band used before warning
+}
+
+// DefaultBandConfig follows the LULD plan's Tier 2 percentages.
+func DefaultBandConfig() BandConfig {
+	return BandConfig{
+		Tiers: []BandTier{
+			{MinPrice: 0, Pct: 75, MaxWidth: 0.15},
+			{MinPrice: 0.75, Pct: 20},
+			{MinPrice: 3, Pct: 10},
+		},
+		ReferenceWindowSeconds: 300,
+		WarningUsage:           0.75,
+	}
+}
+
+func (c BandConfig) Validate() error {
+	if len(c.Tiers) == 0 {
+		return fmt.Errorf("at least one band tier is required")
+	}
+	if c.ReferenceWindowSeconds < 1 {
+		return fmt.Errorf("reference window must be at least 1 second")
+	}
+	if c.WarningUsage <= 0 || c.WarningUsage >= 1 {
+		return fmt.Errorf("warning usage must be between 0 and 1")
+	}
+	check := func(tiers []BandTier) error {
+		for _, t := range tiers {
+			if t.Pct <= 0 || t.MinPrice < 0 || t.MaxWidth < 0 {
+				return fmt.Errorf("invalid tier %+v", t)
+			}
+		}
+		return nil
+	}
+	if err := check(c.Tiers); err != nil {
+		return err
+	}
+	for symbol, tiers := range c.Symbols {
+		if len(tiers) == 0 {
+			return fmt.Errorf("%s: at least one band tier is required", symbol)
+		}
+		if err := check(tiers); err != nil {
+			return fmt.Errorf("%s: %w", symbol, err)
+		}
+	}
+	return nil
+}
+
+// BandStatus is a symbol's position within its price bands. Usage is the
+// signed share of the distance from the reference price to the band that the
+// price has covered: ±1 at the bands and beyond them on a breach.
+type BandStatus struct {
+	Symbol    string    `json:"symbol"`
+	Price     float64   `json:"price"`
+	Reference float64   `json:"reference"`
+	Lower     float64   `json:"lower"`
+	Upper     float64   `json:"upper"`
+	Pct       float64   `json:"pct"`
+	Usage     float64   `json:"usage"`
+	State     string    `json:"state"`
+	Side      string    `json:"side,omitempty"` // "upper" or "lower"
+	Time      time.Time `json:"time"`
+}
+
+// BandMonitor computes reference prices as the mean price over the trailing
+// reference window and checks each new price against the bands around it.
+type BandMonitor struct {
+	config  BandConfig
+	symbols map[string]*bandState
+	mu      sync.Mutex
+}
+
+type bandState struct {
+	prices []float64
+	times  []time.Time
+	status BandStatus
+}
+
+func NewBandMonitor(config BandConfig) (*BandMonitor, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	config.Tiers = sortedTiers(config.Tiers)
+	symbols := make(map[string][]BandTier, len(config.Symbols))
+	for symbol, tiers := range config.Symbols {
+		symbols[strings.ToUpper(symbol)] = sortedTiers(tiers)
+	}
+	config.Symbols = symbols
+	return &BandMonitor{config: config, symbols: make(map[string]*bandState)}, nil
+}
+
+func sortedTiers(tiers []BandTier) []BandTier {
+	out := append([]BandTier(nil), tiers...)
+	sort.Slice(out, func(i, j int) bool { return out[i].MinPrice < out[j].MinPrice })
+	return out
+}
+
+// Update checks price against the bands built from earlier prices and then
+// adds it to the reference window. The returned status is an event to
+// publish when the symbol has moved into a worse state or switched sides.
+func (bm *BandMonitor) Update(symbol string, price float64, ts time.Time) (BandStatus, bool) {
+	if price <= 0 {
+		return BandStatus{}, false
+	}
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+
+	st, ok := bm.symbols[symbol]
+	if !ok {
+		st = &bandState{}
+		bm.symbols[symbol] = st
+	}
+	// Drop prices that have aged out of the reference window
+	cutoff := ts.Add(-time.Duration(bm.config.ReferenceWindowSeconds) * time.Second)
+	drop := 0
+	for drop < len(st.times) && st.times[drop].Before(cutoff) {
+		drop++
+	}
+	st.prices, st.times = st.prices[drop:], st.times[drop:]
+
+	var event bool
+	if len(st.prices) > 0 {
+		prev := st.status
+		status := bm.check(symbol, mean(st.prices), price, ts)
+		event = status.State != BandNormal &&
+			(bandRank(status.State) > bandRank(prev.State) || status.Side != prev.Side)
+		st.status = status
+	}
+	st.prices = append(st.prices, price)
+	st.times = append(st.times, ts)
+	return st.status, event
+}
+
+func (bm *BandMonitor) check(symbol string, reference, price float64, ts time.Time) BandStatus {
+	tiers, ok := bm.config.Symbols[symbol]
+	if !ok {
+		tiers = bm.config.Tiers
+	}
+	tier := tiers[0]
+	for _, t := range tiers {
+		if reference >= t.MinPrice {
+			tier = t
+		}
+	}
+	width := reference * tier.Pct / 100
+	if tier.MaxWidth > 0 && width > tier.MaxWidth {
+		width = tier.MaxWidth
+	}
+
+	s := BandStatus{
+		Symbol:    symbol,
+		Price:     price,
+		Reference: reference,
+		Lower:     reference - width,
+		Upper:     reference + width,
+		Pct:       width / reference * 100,
+		Usage:     (price - reference) / width,
+		State:     BandNormal,
+		Time:      ts,
+	}
+	switch {
+	case math.Abs(s.Usage) >= 1:
+		s.State = BandBreach
+	case math.Abs(s.Usage) >= bm.config.WarningUsage:
+		s.State = BandWarning
+	}
+	if s.State != BandNormal {
+		s.Side = "upper"
+		if s.Usage < 0 {
+			s.Side = "lower"
+		}
+	}
+	return s
+}
+
+// Statuses returns the latest status of every monitored symbol.
+func (bm *BandMonitor) Statuses() []BandStatus {
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+	out := make([]BandStatus, 0, len(bm.symbols))
+	for _, st := range bm.symbols {
+		if st.status.Symbol != "" {
+			out = append(out, st.status)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Symbol < out[j].Symbol })
+	return out
+}
+
+func bandRank(state string) int {
+	switch state {
+	case BandBreach:
+		return 2
+	case BandWarning:
+		return 1
+	}
+	return 0
+}
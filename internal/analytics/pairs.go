@@ -0,0 +1,222 @@
+package analytics
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Pair describes a mean-reverting spread Leg1 - HedgeRatio*Leg2. A zero
+// HedgeRatio is estimated by OLS over the rolling window instead.
+type Pair struct {
+	Leg1       string  `json:"leg1"`
+	Leg2       string  `json:"leg2"`
+	HedgeRatio float64 `json:"hedge_ratio,omitempty"`
+	Window     int     `json:"window,omitempty"`
+	EntryZ     float64 `json:"entry_z,omitempty"`
+	ExitZ      float64 `json:"exit_z,omitempty"`
+}
+
+func (p Pair) ID() string {
+	return p.Leg1 + "/" + p.Leg2
+}
+
+type SpreadUpdate struct {
+	Pair       string  `json:"pair"`
+	HedgeRatio float64 `json:"hedge_ratio"`
+	Estimated  bool    `json:"estimated"`
+	Spread     float64 `json:"spread"`
+	Mean       float64 `json:"mean"`
+	StdDev     float64 `json:"std_dev"`
+	ZScore     float64 `json:"z_score"`
+	Samples    int     `json:"samples"`
+	Engaged    bool    `json:"engaged"` // beyond the entry band and not yet back inside the exit band
+}
+
+type PairMonitor struct {
+	pairs  map[string]*pairState
+	prices map[string]float64
+	mu     sync.Mutex
+}
+
+type pairState struct {
+	Pair
+	y, x    []float64
+	engaged bool
+	// Legs that have ticked since the last sample. A sample is taken once
+	// both have, so the spread never pairs a fresh price with a stale one.
+	fresh1, fresh2 bool
+}
+
+func NewPairMonitor() *PairMonitor {
+	return &PairMonitor{
+		pairs:  make(map[string]*pairState),
+		prices: make(map[string]float64),
+	}
+}
+
+func (pm *PairMonitor) Set(p Pair) (Pair, error) {
+	p.Leg1 = strings.ToUpper(p.Leg1)
+	p.Leg2 = strings.ToUpper(p.Leg2)
+	if p.Leg1 == "" || p.Leg2 == "" || p.Leg1 == p.Leg2 {
+		return p, fmt.Errorf("a pair needs two distinct legs")
+	}
+	if p.Window == 0 {
+		p.Window = 60
+	}
+	if p.EntryZ == 0 {
+		p.EntryZ = 2
+	}
+	if p.ExitZ == 0 {
+		p.ExitZ = 0.5
+	}
+	if p.Window < 10 {
+		return p, fmt.Errorf("window must be at least 10")
+	}
+	if p.ExitZ < 0 || p.ExitZ >= p.EntryZ {
+		return p, fmt.Errorf("exit band must be between 0 and the entry band")
+	}
+
+	pm.mu.Lock()
+	pm.pairs[p.ID()] = &pairState{Pair: p}
+	pm.mu.Unlock()
+	return p, nil
+}
+
+func (pm *PairMonitor) Delete(id string) bool {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	if _, ok := pm.pairs[id]; !ok {
+		return false
+	}
+	delete(pm.pairs, id)
+	return true
+}
+
+func (pm *PairMonitor) Pairs() []Pair {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	out := make([]Pair, 0, len(pm.pairs))
+	for _, ps := range pm.pairs {
+		out = append(out, ps.Pair)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID() < out[j].ID() })
+	return out
+}
+
+// Expand replaces pair IDs with their legs so both legs get polled.
+func (pm *PairMonitor) Expand(symbols []string) []string {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	out := make([]string, 0, len(symbols))
+	for _, s := range symbols {
+		if ps, ok := pm.pairs[s]; ok {
+			out = append(out, ps.Leg1, ps.Leg2)
+			continue
+		}
+		out = append(out, s)
+	}
+	return out
+}
+
+// Update records a leg price and recomputes every pair it belongs to once
+// both of the pair's legs have a new price. An anomaly is returned whenever
+// a spread's z-score crosses its entry or exit band.
+func (pm *PairMonitor) Update(symbol string, price float64) ([]SpreadUpdate, []Anomaly) {
+	if price <= 0 {
+		return nil, nil
+	}
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	pm.prices[symbol] = price
+
+	var updates []SpreadUpdate
+	var anomalies []Anomaly
+	for id, ps := range pm.pairs {
+		if ps.Leg1 != symbol && ps.Leg2 != symbol {
+			continue
+		}
+		if ps.Leg1 == symbol {
+			ps.fresh1 = true
+		} else {
+			ps.fresh2 = true
+		}
+		if !ps.fresh1 || !ps.fresh2 {
+			continue
+		}
+		ps.fresh1, ps.fresh2 = false, false
+		ps.y = appendCapped(ps.y, pm.prices[ps.Leg1], ps.Window)
+		ps.x = appendCapped(ps.x, pm.prices[ps.Leg2], ps.Window)
+
+		u, ok := ps.spread()
+		if !ok {
+			continue
+		}
+		u.Pair = id
+
+		switch {
+		case !ps.engaged && math.Abs(u.ZScore) >= ps.EntryZ:
+			ps.engaged = true
+			anomalies = append(anomalies, Anomaly{
+				Symbol:     id,
+				Type:       "spread_entry",
+				Detector:   "pairs",
+				Magnitude:  math.Abs(u.ZScore),
+				Confidence: tailConfidence(u.ZScore),
+				Details:    fmt.Sprintf("Spread z-score %.2f crossed the ±%.2f entry band.", u.ZScore, ps.EntryZ),
+			})
+		case ps.engaged && math.Abs(u.ZScore) <= ps.ExitZ:
+			ps.engaged = false
+			anomalies = append(anomalies, Anomaly{
+				Symbol:     id,
+				Type:       "spread_exit",
+				Detector:   "pairs",
+				Magnitude:  math.Abs(u.ZScore),
+				Confidence: tailConfidence(ps.EntryZ),
+				Details:    fmt.Sprintf("Spread z-score %.2f reverted inside the ±%.2f exit band.", u.ZScore, ps.ExitZ),
+			})
+		}
+		u.Engaged = ps.engaged
+		updates = append(updates, u)
+	}
+	return updates, anomalies
+}
+
+func (ps *pairState) spread() (SpreadUpdate, bool) {
+	if len(ps.y) < 10 {
+		return SpreadUpdate{}, false
+	}
+	u := SpreadUpdate{HedgeRatio: ps.HedgeRatio, Samples: len(ps.y)}
+	if u.HedgeRatio == 0 {
+		varX := variance(ps.x)
+		if varX == 0 {
+			return SpreadUpdate{}, false
+		}
+		u.HedgeRatio = covariance(ps.y, ps.x) / varX
+		u.Estimated = true
+	}
+
+	spreads := make([]float64, len(ps.y))
+	for i := range ps.y {
+		spreads[i] = ps.y[i] - u.HedgeRatio*ps.x[i]
+	}
+	u.Spread = spreads[len(spreads)-1]
+	u.Mean = mean(spreads)
+	u.StdDev = stdDev(spreads)
+	if u.StdDev == 0 {
+		return SpreadUpdate{}, false
+	}
+	u.ZScore = (u.Spread - u.Mean) / u.StdDev
+	return u, true
+}
+
+func appendCapped(xs []float64, x float64, capacity int) []float64 {
+	xs = append(xs, x)
+	if len(xs) > capacity {
+		xs = xs[len(xs)-capacity:]
+	}
+	return xs
+}
@@ -0,0 +1,38 @@
+package analytics
+
+import "testing"
+
+func TestPairSamplesAlignLegs(t *testing.T) {
+	pm := NewPairMonitor()
+	if _, err := pm.Set(Pair{Leg1: "KO", Leg2: "PEP", HedgeRatio: 1, Window: 10}); err != nil {
+		t.Fatal(err)
+	}
+	ps := pm.pairs["KO/PEP"]
+
+	// KO ticks three times for every PEP tick; only the KO price current
+	// when PEP ticks is sampled
+	for i := 0; i < 12; i++ {
+		for j := 0; j < 3; j++ {
+			pm.Update("KO", float64(60+i*3+j))
+		}
+		pm.Update("PEP", float64(150+i))
+	}
+	if len(ps.y) != 10 {
+		t.Fatalf("samples = %d, want 10 (the window)", len(ps.y))
+	}
+	for i := range ps.y {
+		if spread := ps.y[i] - ps.x[i]; spread != float64(60+(i+2)*3+2-(150+i+2)) {
+			t.Errorf("sample %d spread = %v, pairing mismatched ticks", i, spread)
+		}
+	}
+
+	// A leg ticking alone adds no samples
+	updates, _ := pm.Update("KO", 100)
+	updates2, _ := pm.Update("KO", 101)
+	if len(updates) != 0 || len(updates2) != 0 || len(ps.y) != 10 {
+		t.Errorf("one-legged ticks produced updates %v %v", updates, updates2)
+	}
+	if updates, _ := pm.Update("PEP", 170); len(updates) != 1 || ps.y[len(ps.y)-1] != 101 {
+		t.Errorf("update = %v, last KO sample = %v, want one update at 101", updates, ps.y[len(ps.y)-1])
+	}
+}
@@ -0,0 +1,46 @@
+package analytics
+
+import "math"
+
+// RelativeMetrics compares a symbol's returns with a benchmark's over the same
+// sampling intervals. Alpha is the mean excess return per interval and
+// RelativeStrength is the symbol's growth divided by the benchmark's.
+type RelativeMetrics struct {
+	Benchmark        string
+	Beta             float64
+	Alpha            float64
+	Correlation      float64
+	RelativeStrength float64
+	Samples          int
+}
+
+func (ct *CorrelationTracker) Relative(symbol, benchmark string, window int) (RelativeMetrics, bool) {
+	rs, rb := ct.Returns(symbol, benchmark, window)
+	if len(rs) < 3 {
+		return RelativeMetrics{}, false
+	}
+
+	varB := variance(rb)
+	if varB == 0 {
+		return RelativeMetrics{}, false
+	}
+	beta := covariance(rs, rb) / varB
+
+	var sumS, sumB float64
+	for i := range rs {
+		sumS += rs[i]
+		sumB += rb[i]
+	}
+
+	rel := RelativeMetrics{
+		Benchmark:        benchmark,
+		Beta:             beta,
+		Alpha:            mean(rs) - beta*mean(rb),
+		RelativeStrength: math.Exp(sumS - sumB),
+		Samples:          len(rs),
+	}
+	if c, ok := pearson(rs, rb); ok {
+		rel.Correlation = c
+	}
+	return rel, true
+}
@@ -0,0 +1,151 @@
+package analytics
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// MinRiskReturns is the shortest return series ComputeRisk accepts.
+const MinRiskReturns = 10
+
+// RiskReport summarizes downside risk for a price series. VaR and expected
+// shortfall are expressed as positive loss fractions over Horizon periods;
+// Sharpe and Sortino are annualized.
+type RiskReport struct {
+	Symbol          string     `json:"symbol"`
+	Source          string     `json:"source"`
+	Horizon         int        `json:"horizon"`
+	Confidence      float64    `json:"confidence"`
+	Observations    int        `json:"observations"`
+	HistoricalVaR   float64    `json:"historical_var"`
+	ParametricVaR   float64    `json:"parametric_var"`
+	HistoricalES    float64    `json:"historical_es"`
+	ParametricES    float64    `json:"parametric_es"`
+	Sharpe          float64    `json:"sharpe"`
+	Sortino         float64    `json:"sortino"`
+	MaxDrawdown     float64    `json:"max_drawdown"`
+	DrawdownPeak    time.Time  `json:"drawdown_peak"`
+	DrawdownTrough  time.Time  `json:"drawdown_trough"`
+	DrawdownRecover *time.Time `json:"drawdown_recovered"` // nil while still under water
+	RecoveryTime    string     `json:"recovery_time,omitempty"`
+}
+
+// ComputeRisk evaluates prices sampled at times, oldest first. periodsPerYear
+// is the number of sampling periods in a trading year and riskFree the annual
+// risk-free rate used by the Sharpe and Sortino ratios.
+func ComputeRisk(prices []float64, times []time.Time, periodsPerYear float64, horizon int, confidence, riskFree float64) (RiskReport, error) {
+	if len(prices) != len(times) {
+		return RiskReport{}, fmt.Errorf("prices and times differ in length")
+	}
+	if horizon < 1 {
+		return RiskReport{}, fmt.Errorf("horizon must be at least 1")
+	}
+	if confidence <= 0 || confidence >= 1 {
+		return RiskReport{}, fmt.Errorf("confidence must be between 0 and 1")
+	}
+	// Live series report no sampling rate until they span enough time
+	if periodsPerYear <= 0 || math.IsInf(periodsPerYear, 0) || math.IsNaN(periodsPerYear) {
+		return RiskReport{}, fmt.Errorf("not enough history to annualise returns")
+	}
+
+	returns := simpleReturns(prices, 1)
+	if len(returns) < MinRiskReturns {
+		return RiskReport{}, fmt.Errorf("need at least %d returns, have %d", MinRiskReturns, len(returns))
+	}
+
+	report := RiskReport{
+		Horizon:      horizon,
+		Confidence:   confidence,
+		Observations: len(returns),
+	}
+
+	// Historical: use overlapping horizon returns when there are enough of
+	// them, otherwise scale the one-period figures by the square root of time.
+	horizonReturns := returns
+	scale := math.Sqrt(float64(horizon))
+	if horizon > 1 && len(prices)-horizon >= 20 {
+		horizonReturns = simpleReturns(prices, horizon)
+		scale = 1
+	}
+	cutoff := quantile(horizonReturns, 1-confidence)
+	report.HistoricalVaR = -cutoff * scale
+	var tail []float64
+	for _, r := range horizonReturns {
+		if r <= cutoff {
+			tail = append(tail, r)
+		}
+	}
+	report.HistoricalES = -mean(tail) * scale
+
+	mu := mean(returns) * float64(horizon)
+	sigma := stdDev(returns) * math.Sqrt(float64(horizon))
+	z := normInv(confidence)
+	report.ParametricVaR = z*sigma - mu
+	report.ParametricES = sigma*normPDF(z)/(1-confidence) - mu
+
+	rfPerPeriod := riskFree / periodsPerYear
+	excess := make([]float64, len(returns))
+	var downside float64
+	for i, r := range returns {
+		excess[i] = r - rfPerPeriod
+		if excess[i] < 0 {
+			downside += excess[i] * excess[i]
+		}
+	}
+	if sd := stdDev(excess); sd > 0 {
+		report.Sharpe = mean(excess) / sd * math.Sqrt(periodsPerYear)
+	}
+	if dd := math.Sqrt(downside / float64(len(excess))); dd > 0 {
+		report.Sortino = mean(excess) / dd * math.Sqrt(periodsPerYear)
+	}
+
+	peak, trough, recovered := maxDrawdown(prices)
+	if trough > peak {
+		report.MaxDrawdown = (prices[peak] - prices[trough]) / prices[peak]
+		report.DrawdownPeak = times[peak]
+		report.DrawdownTrough = times[trough]
+		if recovered >= 0 {
+			report.DrawdownRecover = &times[recovered]
+			report.RecoveryTime = times[recovered].Sub(times[trough]).String()
+		}
+	}
+	return report, nil
+}
+
+func simpleReturns(prices []float64, lag int) []float64 {
+	var returns []float64
+	for i := lag; i < len(prices); i++ {
+		if prices[i-lag] <= 0 {
+			continue
+		}
+		returns = append(returns, prices[i]/prices[i-lag]-1)
+	}
+	return returns
+}
+
+// maxDrawdown returns the indexes of the peak and trough of the deepest
+// drawdown and of the first price back at the peak, or -1 if none.
+func maxDrawdown(prices []float64) (peak, trough, recovered int) {
+	runningPeak := 0
+	var worst float64
+	for i, p := range prices {
+		if p > prices[runningPeak] {
+			runningPeak = i
+		}
+		if prices[runningPeak] <= 0 {
+			continue
+		}
+		if dd := (prices[runningPeak] - p) / prices[runningPeak]; dd > worst {
+			worst, peak, trough = dd, runningPeak, i
+		}
+	}
+	recovered = -1
+	for i := trough + 1; i < len(prices); i++ {
+		if prices[i] >= prices[peak] {
+			recovered = i
+			break
+		}
+	}
+	return peak, trough, recovered
+}
@@ -0,0 +1,80 @@
+package analytics
+
+import "time"
+
+// SymbolState is a serializable copy of a symbol's rolling window, oldest
+// sample first.
+type SymbolState struct {
+	Prices  []float64   `json:"prices"`
+	Volumes []float64   `json:"volumes"`
+	Times   []time.Time `json:"times"`
+	Last    Tick        `json:"last"`
+	EWMAVar float64     `json:"ewma_var"`
+	EWMAN   int         `json:"ewma_n"`
+}
+
+func (e *Engine) Snapshot() map[string]SymbolState {
+	e.mu.Lock()
+	buffers := make(map[string]*ringBuffer, len(e.buffers))
+	for symbol, rb := range e.buffers {
+		buffers[symbol] = rb
+	}
+	e.mu.Unlock()
+
+	states := make(map[string]SymbolState, len(buffers))
+	for symbol, rb := range buffers {
+		rb.mu.Lock()
+		states[symbol] = SymbolState{
+			Prices:  rb.ordered(rb.prices),
+			Volumes: rb.ordered(rb.volumes),
+			Times:   rb.orderedTimes(),
+			Last:    rb.last,
+			EWMAVar: rb.ewmaVar,
+			EWMAN:   rb.ewmaN,
+		}
+		rb.mu.Unlock()
+	}
+	return states
+}
+
+// Restore replaces the rolling window of symbol with a snapshot. Samples
+// beyond the engine's window size are dropped from the oldest end.
+func (e *Engine) Restore(symbol string, state SymbolState) {
+	rb := newRingBuffer(e.window)
+	n := len(state.Prices)
+	if len(state.Volumes) != n || len(state.Times) != n {
+		return
+	}
+	start := 0
+	if n > e.window {
+		start = n - e.window
+	}
+	for i := start; i < n; i++ {
+		rb.prices[rb.pos] = state.Prices[i]
+		rb.volumes[rb.pos] = state.Volumes[i]
+		rb.times[rb.pos] = state.Times[i]
+		rb.pos = (rb.pos + 1) % rb.size
+		if rb.pos == 0 {
+			rb.full = true
+		}
+	}
+	rb.last = state.Last
+	rb.ewmaVar = state.EWMAVar
+	rb.ewmaN = state.EWMAN
+
+	e.mu.Lock()
+	e.buffers[symbol] = rb
+	e.mu.Unlock()
+}
+
+func (rb *ringBuffer) orderedTimes() []time.Time {
+	count := rb.size
+	if !rb.full {
+		count = rb.pos
+	}
+	out := make([]time.Time, count)
+	for i := 0; i < count; i++ {
+		out[i] = rb.times[(rb.pos-count+i+rb.size)%rb.size]
+	}
+	return out
+}
@@ -0,0 +1,130 @@
+package analytics
+
+import (
+	"math"
+	"sort"
+)
+
+func mean(xs []float64) float64 {
+	if len(xs) == 0 {
+		return 0
+	}
+	var sum float64
+	for _, x := range xs {
+		sum += x
+	}
+	return sum / float64(len(xs))
+}
+
+// stdDev is the sample standard deviation.
+func stdDev(xs []float64) float64 {
+	if len(xs) < 2 {
+		return 0
+	}
+	return math.Sqrt(variance(xs))
+}
+
+// variance is the sample variance.
+func variance(xs []float64) float64 {
+	if len(xs) < 2 {
+		return 0
+	}
+	m := mean(xs)
+	var ss float64
+	for _, x := range xs {
+		ss += (x - m) * (x - m)
+	}
+	return ss / float64(len(xs)-1)
+}
+
+// covariance is the sample covariance of two equal-length series.
+func covariance(x, y []float64) float64 {
+	if len(x) < 2 || len(x) != len(y) {
+		return 0
+	}
+	mx, my := mean(x), mean(y)
+	var s float64
+	for i := range x {
+		s += (x[i] - mx) * (y[i] - my)
+	}
+	return s / float64(len(x)-1)
+}
+
+// pearson returns the correlation of x and y, or false when there are too few
+// points or either series is flat.
+func pearson(x, y []float64) (float64, bool) {
+	if len(x) < 3 || len(x) != len(y) {
+		return 0, false
+	}
+	mx, my := mean(x), mean(y)
+	var sxy, sxx, syy float64
+	for i := range x {
+		dx, dy := x[i]-mx, y[i]-my
+		sxy += dx * dy
+		sxx += dx * dx
+		syy += dy * dy
+	}
+	if sxx == 0 || syy == 0 {
+		return 0, false
+	}
+	return sxy / math.Sqrt(sxx*syy), true
+}
+
+func normPDF(x float64) float64 {
+	return math.Exp(-x*x/2) / math.Sqrt(2*math.Pi)
+}
+
+func normCDF(x float64) float64 {
+	return 0.5 * math.Erfc(-x/math.Sqrt2)
+}
+
+// normInv is the standard normal quantile function.
+func normInv(p float64) float64 {
+	if p <= 0 {
+		return math.Inf(-1)
+	}
+	if p >= 1 {
+		return math.Inf(1)
+	}
+	return -math.Sqrt2 * math.Erfcinv(2*p)
+}
+
+// quantile returns the p-th quantile of xs using linear interpolation.
+func quantile(xs []float64, p float64) float64 {
+	if len(xs) == 0 {
+		return 0
+	}
+	sorted := append([]float64(nil), xs...)
+	sort.Float64s(sorted)
+	pos := p * float64(len(sorted)-1)
+	lo := int(math.Floor(pos))
+	hi := int(math.Ceil(pos))
+	return sorted[lo] + (sorted[hi]-sorted[lo])*(pos-float64(lo))
+}
+
+func median(xs []float64) float64 {
+	return quantile(xs, 0.5)
+}
+
+// robustZ scores x against a sample using the median and MAD. When more than
+// half the sample is identical the MAD is zero, so it falls back to the mean
+// absolute deviation from the median.
+func robustZ(x float64, sample []float64) (float64, bool) {
+	med := median(sample)
+	dev := make([]float64, len(sample))
+	for i, v := range sample {
+		dev[i] = math.Abs(v - med)
+	}
+	if mad := median(dev); mad > 0 {
+		return 0.6745 * (x - med) / mad, true
+	}
+	if meanAD := mean(dev); meanAD > 0 {
+		return (x - med) / (1.253314 * meanAD), true
+	}
+	return 0, false
+}
+
+// tailConfidence is one minus the two-sided normal tail probability of z.
+func tailConfidence(z float64) float64 {
+	return 1 - 2*(1-normCDF(math.Abs(z)))
+}
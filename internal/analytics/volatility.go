@@ -0,0 +1,152 @@
+package analytics
+
+import (
+	"fmt"
+	"math"
+)
+
+type VolatilityEstimator string
+
+const (
+	EstimatorPriceStdDev VolatilityEstimator = "price_stddev"
+	EstimatorLogReturn   VolatilityEstimator = "log_return"
+	EstimatorEWMA        VolatilityEstimator = "ewma"
+	EstimatorParkinson   VolatilityEstimator = "parkinson"
+	EstimatorGarmanKlass VolatilityEstimator = "garman_klass"
+)
+
+const (
+	tradingDaysPerYear    = 252
+	tradingSecondsPerYear = tradingDaysPerYear * 6.5 * 3600
+	ewmaLambda            = 0.94 // RiskMetrics decay factor
+)
+
+func ParseVolatilityEstimator(s string) (VolatilityEstimator, error) {
+	switch e := VolatilityEstimator(s); e {
+	case EstimatorPriceStdDev, EstimatorLogReturn, EstimatorEWMA, EstimatorParkinson, EstimatorGarmanKlass:
+		return e, nil
+	}
+	return "", fmt.Errorf("unknown volatility estimator %q", s)
+}
+
+// VolatilityEstimates holds every estimator's result. All values except
+// PriceStdDev (which is in price units) are annualized fractions.
+type VolatilityEstimates struct {
+	PriceStdDev float64
+	LogReturn   float64
+	EWMA        float64
+	Parkinson   float64
+	GarmanKlass float64
+}
+
+func (v VolatilityEstimates) Get(e VolatilityEstimator) float64 {
+	switch e {
+	case EstimatorPriceStdDev:
+		return v.PriceStdDev
+	case EstimatorEWMA:
+		return v.EWMA
+	case EstimatorParkinson:
+		return v.Parkinson
+	case EstimatorGarmanKlass:
+		return v.GarmanKlass
+	}
+	return v.LogReturn
+}
+
+func (rb *ringBuffer) computeVolatilityEstimates() VolatilityEstimates {
+	est := VolatilityEstimates{
+		PriceStdDev: rb.computeVolatility(),
+		Parkinson:   parkinson(rb.last.High, rb.last.Low),
+		GarmanKlass: garmanKlass(rb.last.Open, rb.last.High, rb.last.Low, rb.last.Price),
+	}
+
+	returns := rb.logReturns()
+	if len(returns) < 2 {
+		return est
+	}
+	annualize := rb.annualizationFactor()
+	est.LogReturn = stdDev(returns) * annualize
+	est.EWMA = math.Sqrt(rb.ewmaVar) * annualize
+	return est
+}
+
+func (rb *ringBuffer) updateEWMA(price float64) {
+	prev := rb.prices[(rb.pos-1+rb.size)%rb.size]
+	if prev <= 0 || price <= 0 {
+		return
+	}
+	r := math.Log(price / prev)
+	if rb.ewmaN == 0 {
+		rb.ewmaVar = r * r
+	} else {
+		rb.ewmaVar = ewmaLambda*rb.ewmaVar + (1-ewmaLambda)*r*r
+	}
+	rb.ewmaN++
+}
+
+// logReturns returns successive log returns in chronological order.
+func (rb *ringBuffer) logReturns() []float64 {
+	prices := rb.ordered(rb.prices)
+	returns := make([]float64, 0, len(prices))
+	for i := 1; i < len(prices); i++ {
+		if prices[i-1] <= 0 || prices[i] <= 0 {
+			continue
+		}
+		returns = append(returns, math.Log(prices[i]/prices[i-1]))
+	}
+	return returns
+}
+
+// annualizationFactor scales a per-sample volatility to a yearly one using the
+// observed spacing between samples.
+func (rb *ringBuffer) annualizationFactor() float64 {
+	count := rb.size
+	if !rb.full {
+		count = rb.pos
+	}
+	if count < 2 {
+		return 0
+	}
+	first := rb.times[(rb.pos-count+rb.size)%rb.size]
+	last := rb.times[(rb.pos-1+rb.size)%rb.size]
+	meanInterval := last.Sub(first).Seconds() / float64(count-1)
+	if meanInterval <= 0 {
+		return 0
+	}
+	return math.Sqrt(tradingSecondsPerYear / meanInterval)
+}
+
+func (rb *ringBuffer) ordered(values []float64) []float64 {
+	count := rb.size
+	if !rb.full {
+		count = rb.pos
+	}
+	out := make([]float64, count)
+	for i := 0; i < count; i++ {
+		out[i] = values[(rb.pos-count+i+rb.size)%rb.size]
+	}
+	return out
+}
+
+// parkinson estimates volatility from the session high/low range.
+func parkinson(high, low float64) float64 {
+	if high <= 0 || low <= 0 || high < low {
+		return 0
+	}
+	hl := math.Log(high / low)
+	return math.Sqrt(tradingDaysPerYear * hl * hl / (4 * math.Ln2))
+}
+
+// garmanKlass extends Parkinson with the open-to-close move.
+func garmanKlass(open, high, low, close float64) float64 {
+	if open <= 0 || high <= 0 || low <= 0 || close <= 0 || high < low {
+		return 0
+	}
+	hl := math.Log(high / low)
+	co := math.Log(close / open)
+	variance := 0.5*hl*hl - (2*math.Ln2-1)*co*co
+	if variance < 0 {
+		return 0
+	}
+	return math.Sqrt(tradingDaysPerYear * variance)
+}
@@ -0,0 +1,50 @@
+package analytics
+
+import "sync"
+
+// VolumeTracker turns the cumulative session volume reported by GLOBAL_QUOTE
+// into the volume actually traded between successive readings.
+type VolumeTracker struct {
+	last map[string]volumeReading
+	mu   sync.Mutex
+}
+
+type volumeReading struct {
+	cumulative int64
+	tradingDay string
+}
+
+func NewVolumeTracker() *VolumeTracker {
+	return &VolumeTracker{
+		last: make(map[string]volumeReading),
+	}
+}
+
+func (vt *VolumeTracker) Delta(symbol string, cumulative int64, tradingDay string) float64 {
+	vt.mu.Lock()
+	defer vt.mu.Unlock()
+
+	prev, ok := vt.last[symbol]
+	current := volumeReading{cumulative: cumulative, tradingDay: tradingDay}
+
+	switch {
+	case !ok:
+		// No baseline yet, so the interval volume is unknown
+		vt.last[symbol] = current
+		return 0
+	case tradingDay < prev.tradingDay:
+		// A late reading from an earlier session was already counted
+		return 0
+	case tradingDay > prev.tradingDay:
+		// New session: the counter restarted from zero. Trading days are
+		// YYYY-MM-DD, so they order as strings
+		vt.last[symbol] = current
+		return float64(cumulative)
+	case cumulative < prev.cumulative:
+		// Out-of-order or corrected reading; keep the higher baseline so
+		// the next reading doesn't count volume already reported
+		return 0
+	}
+	vt.last[symbol] = current
+	return float64(cumulative - prev.cumulative)
+}
@@ -0,0 +1,27 @@
+package analytics
+
+import "testing"
+
+func TestVolumeDelta(t *testing.T) {
+	vt := NewVolumeTracker()
+	tests := []struct {
+		cumulative int64
+		day        string
+		want       float64
+	}{
+		{1000, "2026-10-16", 0}, // no baseline yet
+		{1500, "2026-10-16", 500},
+		{1400, "2026-10-16", 0}, // out of order within the session
+		{1600, "2026-10-16", 100},
+		{300, "2026-10-17", 300}, // new session
+		{200, "2026-10-16", 0},   // late reading from the previous session
+		{1000, "2026-10-18", 1000},
+		{900, "2026-10-17", 0},
+		{1100, "2026-10-18", 100},
+	}
+	for i, tt := range tests {
+		if got := vt.Delta("AAPL", tt.cumulative, tt.day); got != tt.want {
+			t.Errorf("reading %d: Delta(%d, %s) = %v, want %v", i, tt.cumulative, tt.day, got, tt.want)
+		}
+	}
+}
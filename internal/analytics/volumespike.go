@@ -0,0 +1,169 @@
+package analytics
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// VolumeSpikeDetector compares the rate at which volume traded since the
+// previous observation with what is normal for that symbol at that time of
+// day, so the heavy volume around the open and close auctions is expected
+// rather than flagged.
+type VolumeSpikeDetector struct {
+	Threshold        float64 `json:"threshold"` // observed/expected volume rate
+	BucketMinutes    int     `json:"bucket_minutes"`
+	MinBucketSamples int     `json:"min_bucket_samples"`
+
+	profiles map[string]*volumeProfile
+	mu       sync.Mutex
+}
+
+type volumeProfile struct {
+	buckets  map[int]*bucketStats
+	lastTime time.Time
+}
+
+// bucketStats tracks the mean and variance of log volume rate for one
+// time-of-day bucket using exponential weighting once warmed up.
+type bucketStats struct {
+	n        int
+	mean     float64
+	variance float64
+}
+
+var marketLocation = loadMarketLocation()
+
+func loadMarketLocation() *time.Location {
+	if loc, err := time.LoadLocation("America/New_York"); err == nil {
+		return loc
+	}
+	return time.FixedZone("EST", -5*3600)
+}
+
+func NewVolumeSpikeDetector() *VolumeSpikeDetector {
+	return &VolumeSpikeDetector{
+		Threshold:        3.0,
+		BucketMinutes:    30,
+		MinBucketSamples: 5,
+		profiles:         make(map[string]*volumeProfile),
+	}
+}
+
+func (d *VolumeSpikeDetector) Name() string { return "volume_spike" }
+
+func (d *VolumeSpikeDetector) Validate() error {
+	switch {
+	case d.Threshold <= 0:
+		return fmt.Errorf("threshold must be positive")
+	case d.BucketMinutes <= 0 || d.BucketMinutes > 24*60:
+		return fmt.Errorf("bucket_minutes must be between 1 and 1440")
+	case d.MinBucketSamples <= 0:
+		return fmt.Errorf("min_bucket_samples must be positive")
+	}
+	return nil
+}
+
+func (d *VolumeSpikeDetector) Detect(obs Observation) []Anomaly {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	p := d.profile(obs.Symbol)
+	rate, ok := p.rate(obs.Tick)
+	if !ok {
+		return nil
+	}
+	b := p.bucket(d.bucketOf(obs.Tick.Time))
+	lr := math.Log(rate)
+
+	var anomalies []Anomaly
+	if b.n >= d.MinBucketSamples {
+		expected := math.Exp(b.mean)
+		ratio := rate / expected
+		if ratio >= d.Threshold {
+			confidence := 0.5
+			if sd := math.Sqrt(b.variance); sd > 0 {
+				confidence = tailConfidence((lr - b.mean) / sd)
+			}
+			anomalies = append(anomalies, Anomaly{
+				Symbol:     obs.Symbol,
+				Type:       "volume_spike",
+				Magnitude:  ratio,
+				Confidence: confidence,
+				Details:    fmt.Sprintf("Volume is trading at %.1fx the usual rate for this time of day.", ratio),
+			})
+		}
+	}
+	b.add(lr)
+	return anomalies
+}
+
+// Seed builds the time-of-day baseline from historical ticks, oldest first,
+// whose Volume is interval volume.
+func (d *VolumeSpikeDetector) Seed(symbol string, history []Tick) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	p := d.profile(symbol)
+	for _, t := range history {
+		if rate, ok := p.rate(t); ok {
+			p.bucket(d.bucketOf(t.Time)).add(math.Log(rate))
+		}
+	}
+}
+
+func (d *VolumeSpikeDetector) profile(symbol string) *volumeProfile {
+	p, ok := d.profiles[symbol]
+	if !ok {
+		p = &volumeProfile{buckets: make(map[int]*bucketStats)}
+		d.profiles[symbol] = p
+	}
+	return p
+}
+
+func (d *VolumeSpikeDetector) bucketOf(t time.Time) int {
+	minutes := d.BucketMinutes
+	if minutes <= 0 {
+		minutes = 30
+	}
+	local := t.In(marketLocation)
+	return (local.Hour()*60 + local.Minute()) / minutes
+}
+
+// rate returns the volume per second traded since the profile's previous
+// tick. Ticks spanning a session boundary or without volume are skipped.
+func (p *volumeProfile) rate(t Tick) (float64, bool) {
+	prev := p.lastTime
+	p.lastTime = t.Time
+	if prev.IsZero() || t.Volume <= 0 {
+		return 0, false
+	}
+	elapsed := t.Time.Sub(prev)
+	if elapsed <= 0 || elapsed > 2*time.Hour {
+		return 0, false
+	}
+	return t.Volume / elapsed.Seconds(), true
+}
+
+func (p *volumeProfile) bucket(i int) *bucketStats {
+	b, ok := p.buckets[i]
+	if !ok {
+		b = &bucketStats{}
+		p.buckets[i] = b
+	}
+	return b
+}
+
+func (b *bucketStats) add(x float64) {
+	b.n++
+	// Plain running mean until warmed up, then exponential weighting so the
+	// baseline follows slow shifts in activity
+	alpha := 1 / float64(b.n)
+	if alpha < 0.05 {
+		alpha = 0.05
+	}
+	diff := x - b.mean
+	b.mean += alpha * diff
+	b.variance = (1 - alpha) * (b.variance + alpha*diff*diff)
+}
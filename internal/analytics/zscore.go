@@ -0,0 +1,105 @@
+package analytics
+
+import (
+	"fmt"
+	"math"
+	"sync"
+)
+
+// RobustZScoreDetector keeps a per-symbol baseline of log returns and log
+// interval volumes and flags observations whose median/MAD z-score exceeds
+// Sensitivity. Because the baseline is per symbol, a 1% move is judged
+// against that symbol's own typical moves rather than a fixed threshold.
+type RobustZScoreDetector struct {
+	Sensitivity float64 `json:"sensitivity"`
+	Window      int     `json:"window"`
+	MinSamples  int     `json:"min_samples"`
+
+	baselines map[string]*zBaseline
+	mu        sync.Mutex
+}
+
+type zBaseline struct {
+	returns   []float64
+	volumes   []float64
+	lastPrice float64
+}
+
+func NewRobustZScoreDetector() *RobustZScoreDetector {
+	return &RobustZScoreDetector{
+		Sensitivity: 3.5,
+		Window:      200,
+		MinSamples:  30,
+		baselines:   make(map[string]*zBaseline),
+	}
+}
+
+func (d *RobustZScoreDetector) Name() string { return "robust_zscore" }
+
+func (d *RobustZScoreDetector) Validate() error {
+	switch {
+	case d.Sensitivity <= 0:
+		return fmt.Errorf("sensitivity must be positive")
+	case d.Window <= 0:
+		return fmt.Errorf("window must be positive")
+	case d.MinSamples <= 0 || d.MinSamples > d.Window:
+		return fmt.Errorf("min_samples must be between 1 and window")
+	}
+	return nil
+}
+
+func (d *RobustZScoreDetector) Detect(obs Observation) []Anomaly {
+	price, volume := obs.Tick.Price, obs.Tick.Volume
+	if price <= 0 {
+		return nil
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	b, ok := d.baselines[obs.Symbol]
+	if !ok {
+		b = &zBaseline{}
+		d.baselines[obs.Symbol] = b
+	}
+	if b.lastPrice == 0 {
+		b.lastPrice = price
+		return nil
+	}
+	r := math.Log(price / b.lastPrice)
+	b.lastPrice = price
+	// An unchanged price with no traded volume is a repeated quote
+	if r == 0 && volume == 0 {
+		return nil
+	}
+	lv := math.Log1p(volume)
+
+	var anomalies []Anomaly
+	if len(b.returns) >= d.MinSamples {
+		if z, ok := robustZ(r, b.returns); ok && math.Abs(z) >= d.Sensitivity {
+			anomalies = append(anomalies, Anomaly{
+				Symbol:     obs.Symbol,
+				Type:       "return_outlier",
+				Magnitude:  math.Abs(z),
+				Confidence: tailConfidence(z),
+				Details:    fmt.Sprintf("%.3f%% move is %.1f robust standard deviations from this symbol's norm.", 100*(math.Exp(r)-1), z),
+			})
+		}
+	}
+	if len(b.volumes) >= d.MinSamples && volume > 0 {
+		if z, ok := robustZ(lv, b.volumes); ok && z >= d.Sensitivity {
+			anomalies = append(anomalies, Anomaly{
+				Symbol:     obs.Symbol,
+				Type:       "volume_outlier",
+				Magnitude:  z,
+				Confidence: tailConfidence(z),
+				Details:    fmt.Sprintf("Interval volume of %.0f is %.1f robust standard deviations above this symbol's norm.", volume, z),
+			})
+		}
+	}
+
+	// Update after scoring so an outlier cannot mask itself
+	b.returns = appendCapped(b.returns, r, d.Window)
+	b.volumes = appendCapped(b.volumes, lv, d.Window)
+	return anomalies
+}
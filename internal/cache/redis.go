@@ -2,6 +2,7 @@ package cache
 
 import (
 	"context"
+	"strings"
 	"time"
 
 	"github.com/redis/go-redis/v9"
@@ -40,3 +41,23 @@ func (rc *RedisCache) GetHotSymbols(ctx context.Context, limit int64) ([]string,
 	// For now, just return anything with subs > 0
 	return rc.Client.Keys(ctx, "subs:*").Result()
 }
+
+func (rc *RedisCache) SetAnalyticsState(ctx context.Context, symbol string, state []byte) error {
+	return rc.Client.Set(ctx, "analytics:"+symbol, state, 7*24*time.Hour).Err()
+}
+
+func (rc *RedisCache) GetAnalyticsStates(ctx context.Context) (map[string][]byte, error) {
+	keys, err := rc.Client.Keys(ctx, "analytics:*").Result()
+	if err != nil {
+		return nil, err
+	}
+	states := make(map[string][]byte, len(keys))
+	for _, key := range keys {
+		data, err := rc.Client.Get(ctx, key).Bytes()
+		if err != nil {
+			continue
+		}
+		states[strings.TrimPrefix(key, "analytics:")] = data
+	}
+	return states, nil
+}
@@ -1,7 +1,10 @@
 package db
 
 import (
+	"context"
 	"database/sql"
+	"fmt"
+	"time"
 
 	_ "github.com/lib/pq"
 )
@@ -47,6 +50,83 @@ func (pg *PostgresDB) initSchema() error {
 		description TEXT,
 		timestamp TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 	);
+
+	ALTER TABLE anomalies ALTER COLUMN symbol TYPE VARCHAR(32);
+	ALTER TABLE anomalies ADD COLUMN IF NOT EXISTS detector VARCHAR(50);
+	ALTER TABLE anomalies ADD COLUMN IF NOT EXISTS metrics JSONB;
+	ALTER TABLE anomalies ADD COLUMN IF NOT EXISTS severity VARCHAR(10);
+	ALTER TABLE anomalies ADD COLUMN IF NOT EXISTS status VARCHAR(10);
+	ALTER TABLE anomalies ADD COLUMN IF NOT EXISTS episode_id VARCHAR(32);
+	CREATE INDEX IF NOT EXISTS idx_anomalies_symbol_timestamp ON anomalies (symbol, timestamp DESC);
+	ALTER TABLE anomalies ADD COLUMN IF NOT EXISTS anomaly_id VARCHAR(32);
+	ALTER TABLE anomalies ADD COLUMN IF NOT EXISTS label VARCHAR(10);
+	ALTER TABLE anomalies ADD COLUMN IF NOT EXISTS labelled_at TIMESTAMP;
+	CREATE UNIQUE INDEX IF NOT EXISTS idx_anomalies_anomaly_id ON anomalies (anomaly_id);
+
+	CREATE TABLE IF NOT EXISTS candles (
+		symbol VARCHAR(10) NOT NULL,
+		resolution VARCHAR(8) NOT NULL,
+		start_time TIMESTAMP NOT NULL,
+		open DECIMAL(18, 4) NOT NULL,
+		high DECIMAL(18, 4) NOT NULL,
+		low DECIMAL(18, 4) NOT NULL,
+		close DECIMAL(18, 4) NOT NULL,
+		volume BIGINT NOT NULL,
+		PRIMARY KEY (symbol, resolution, start_time)
+	);
+
+	CREATE TABLE IF NOT EXISTS analytics_state (
+		symbol VARCHAR(10) PRIMARY KEY,
+		state JSONB NOT NULL,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE TABLE IF NOT EXISTS baskets (
+		name VARCHAR(10) PRIMARY KEY,
+		weights JSONB NOT NULL,
+		base JSONB,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE TABLE IF NOT EXISTS pairs (
+		id VARCHAR(32) PRIMARY KEY,
+		config JSONB NOT NULL,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE TABLE IF NOT EXISTS alerts (
+		id VARCHAR(32) PRIMARY KEY,
+		user_id VARCHAR(64) NOT NULL,
+		config JSONB NOT NULL,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE INDEX IF NOT EXISTS idx_alerts_user ON alerts (user_id);
+
+	CREATE TABLE IF NOT EXISTS webhooks (
+		id VARCHAR(32) PRIMARY KEY,
+		config JSONB NOT NULL,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE TABLE IF NOT EXISTS webhook_deliveries (
+		id SERIAL PRIMARY KEY,
+		webhook_id VARCHAR(32) NOT NULL,
+		event_id VARCHAR(32) NOT NULL,
+		event_type VARCHAR(20) NOT NULL,
+		payload TEXT NOT NULL,
+		status VARCHAR(10) NOT NULL DEFAULT 'pending',
+		attempts INT NOT NULL DEFAULT 0,
+		next_attempt_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		last_error TEXT,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_due ON webhook_deliveries (status, next_attempt_at);
+
+	CREATE TABLE IF NOT EXISTS rules (
+		name VARCHAR(40) PRIMARY KEY,
+		config JSONB NOT NULL,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
 	`
 	_, err := pg.Conn.Exec(schema)
 	return err
@@ -60,9 +140,327 @@ func (pg *PostgresDB) SaveQuote(symbol string, price float64, volume int64) erro
 	return err
 }
 
+type AnomalyRecord struct {
+	ID          string
+	Symbol      string
+	Type        string
+	Detector    string
+	Severity    string
+	Status      string
+	EpisodeID   string
+	Confidence  float64
+	Description string
+	Metrics     []byte
+}
+
+func (pg *PostgresDB) SaveAnomaly(a AnomalyRecord) error {
+	_, err := pg.Conn.Exec(
+		`INSERT INTO anomalies (anomaly_id, symbol, type, detector, severity, status, episode_id, confidence, description, metrics)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`,
+		a.ID, a.Symbol, a.Type, a.Detector, a.Severity, a.Status, a.EpisodeID, a.Confidence, a.Description, a.Metrics,
+	)
+	return err
+}
+
+// LabelAnomaly stores a feedback label on an anomaly and returns its
+// detector, symbol and any label it replaced. Rows stored before anomalies
+// had IDs are addressed by their numeric row id.
+func (pg *PostgresDB) LabelAnomaly(id, label string) (detector, symbol, previous string, err error) {
+	err = pg.Conn.QueryRow(
+		`UPDATE anomalies a SET label = $2, labelled_at = CURRENT_TIMESTAMP
+		FROM (SELECT id, label FROM anomalies WHERE anomaly_id = $1 OR (anomaly_id IS NULL AND id::text = $1) LIMIT 1) prev
+		WHERE a.id = prev.id
+		RETURNING COALESCE(a.detector, ''), a.symbol, COALESCE(prev.label, '')`,
+		id, label,
+	).Scan(&detector, &symbol, &previous)
+	return
+}
+
+// GetLabelCounts returns the number of anomalies per detector, symbol and
+// label, and when the latest of them was labelled.
+func (pg *PostgresDB) GetLabelCounts() (*sql.Rows, error) {
+	return pg.Conn.Query(
+		`SELECT COALESCE(detector, ''), symbol, label, COUNT(*), MAX(labelled_at) FROM anomalies
+		WHERE label IS NOT NULL GROUP BY detector, symbol, label`,
+	)
+}
+
+type AnomalyFilter struct {
+	Symbol string
+	Type   string
+	From   time.Time
+	To     time.Time
+	Limit  int
+	Offset int
+}
+
+// GetAnomalies returns anomalies matching every non-zero filter field, newest first.
+func (pg *PostgresDB) GetAnomalies(f AnomalyFilter) (*sql.Rows, error) {
+	query := `SELECT COALESCE(anomaly_id, id::text), symbol, type, COALESCE(detector, ''), COALESCE(severity, ''), COALESCE(status, ''), COALESCE(episode_id, ''),
+		confidence, COALESCE(description, ''), metrics, COALESCE(label, ''), timestamp FROM anomalies WHERE 1=1`
+	var args []interface{}
+	if f.Symbol != "" {
+		args = append(args, f.Symbol)
+		query += fmt.Sprintf(" AND symbol = $%d", len(args))
+	}
+	if f.Type != "" {
+		args = append(args, f.Type)
+		query += fmt.Sprintf(" AND type = $%d", len(args))
+	}
+	if !f.From.IsZero() {
+		args = append(args, f.From)
+		query += fmt.Sprintf(" AND timestamp >= $%d", len(args))
+	}
+	if !f.To.IsZero() {
+		args = append(args, f.To)
+		query += fmt.Sprintf(" AND timestamp < $%d", len(args))
+	}
+	args = append(args, f.Limit, f.Offset)
+	query += fmt.Sprintf(" ORDER BY timestamp DESC, id DESC LIMIT $%d OFFSET $%d", len(args)-1, len(args))
+	return pg.Conn.Query(query, args...)
+}
+
+func (pg *PostgresDB) SaveCandle(symbol, resolution string, start time.Time, open, high, low, close float64, volume int64) error {
+	_, err := pg.Conn.Exec(
+		`INSERT INTO candles (symbol, resolution, start_time, open, high, low, close, volume)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (symbol, resolution, start_time) DO UPDATE
+		SET high = EXCLUDED.high, low = EXCLUDED.low, close = EXCLUDED.close, volume = EXCLUDED.volume`,
+		symbol, resolution, start, open, high, low, close, volume,
+	)
+	return err
+}
+
+func (pg *PostgresDB) GetCandles(symbol, resolution string, limit int) (*sql.Rows, error) {
+	return pg.Conn.Query(
+		"SELECT start_time, open, high, low, close, volume FROM candles WHERE symbol = $1 AND resolution = $2 ORDER BY start_time DESC LIMIT $3",
+		symbol, resolution, limit,
+	)
+}
+
 func (pg *PostgresDB) GetHistoricalData(symbol string, limit int) (*sql.Rows, error) {
 	return pg.Conn.Query(
 		"SELECT price, volume, timestamp FROM market_data WHERE symbol = $1 ORDER BY timestamp DESC LIMIT $2",
 		symbol, limit,
 	)
 }
+
+// GetDailyCloses returns the last stored price of each of the symbol's most
+// recent days, oldest first.
+func (pg *PostgresDB) GetDailyCloses(symbol string, days int) (*sql.Rows, error) {
+	return pg.Conn.Query(
+		`SELECT day, price FROM (
+			SELECT DISTINCT ON (timestamp::date) timestamp::date AS day, price FROM market_data
+			WHERE symbol = $1 ORDER BY timestamp::date DESC, timestamp DESC LIMIT $2
+		) closes ORDER BY day ASC`,
+		symbol, days,
+	)
+}
+
+// GetMarketDataRange returns stored quotes for symbol between from and to,
+// oldest first.
+func (pg *PostgresDB) GetMarketDataRange(ctx context.Context, symbol string, from, to time.Time, limit int) (*sql.Rows, error) {
+	return pg.Conn.QueryContext(ctx,
+		`SELECT price, volume, timestamp FROM market_data
+		WHERE symbol = $1 AND timestamp >= $2 AND timestamp <= $3
+		ORDER BY timestamp ASC LIMIT $4`,
+		symbol, from, to, limit,
+	)
+}
+
+func (pg *PostgresDB) SaveAnalyticsState(symbol string, state []byte) error {
+	_, err := pg.Conn.Exec(
+		`INSERT INTO analytics_state (symbol, state, updated_at) VALUES ($1, $2, CURRENT_TIMESTAMP)
+		ON CONFLICT (symbol) DO UPDATE SET state = EXCLUDED.state, updated_at = EXCLUDED.updated_at`,
+		symbol, state,
+	)
+	return err
+}
+
+func (pg *PostgresDB) GetAnalyticsStates() (map[string][]byte, error) {
+	rows, err := pg.Conn.Query("SELECT symbol, state FROM analytics_state")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	states := make(map[string][]byte)
+	for rows.Next() {
+		var symbol string
+		var state []byte
+		if err := rows.Scan(&symbol, &state); err != nil {
+			return nil, err
+		}
+		states[symbol] = state
+	}
+	return states, rows.Err()
+}
+
+func (pg *PostgresDB) SaveBasket(name string, weights, base []byte) error {
+	_, err := pg.Conn.Exec(
+		`INSERT INTO baskets (name, weights, base, updated_at) VALUES ($1, $2, $3, CURRENT_TIMESTAMP)
+		ON CONFLICT (name) DO UPDATE SET weights = EXCLUDED.weights, base = EXCLUDED.base, updated_at = EXCLUDED.updated_at`,
+		name, weights, base,
+	)
+	return err
+}
+
+func (pg *PostgresDB) DeleteBasket(name string) error {
+	_, err := pg.Conn.Exec("DELETE FROM baskets WHERE name = $1", name)
+	return err
+}
+
+func (pg *PostgresDB) GetBaskets() (*sql.Rows, error) {
+	return pg.Conn.Query("SELECT name, weights, base FROM baskets")
+}
+
+func (pg *PostgresDB) SavePair(id string, config []byte) error {
+	_, err := pg.Conn.Exec(
+		`INSERT INTO pairs (id, config, updated_at) VALUES ($1, $2, CURRENT_TIMESTAMP)
+		ON CONFLICT (id) DO UPDATE SET config = EXCLUDED.config, updated_at = EXCLUDED.updated_at`,
+		id, config,
+	)
+	return err
+}
+
+func (pg *PostgresDB) DeletePair(id string) error {
+	_, err := pg.Conn.Exec("DELETE FROM pairs WHERE id = $1", id)
+	return err
+}
+
+func (pg *PostgresDB) GetPairs() (*sql.Rows, error) {
+	return pg.Conn.Query("SELECT config FROM pairs")
+}
+
+func (pg *PostgresDB) SaveAlert(id, user string, config []byte) error {
+	_, err := pg.Conn.Exec(
+		`INSERT INTO alerts (id, user_id, config, updated_at) VALUES ($1, $2, $3, CURRENT_TIMESTAMP)
+		ON CONFLICT (id) DO UPDATE SET config = EXCLUDED.config, updated_at = EXCLUDED.updated_at`,
+		id, user, config,
+	)
+	return err
+}
+
+func (pg *PostgresDB) DeleteAlert(id string) error {
+	_, err := pg.Conn.Exec("DELETE FROM alerts WHERE id = $1", id)
+	return err
+}
+
+func (pg *PostgresDB) GetAlerts() (*sql.Rows, error) {
+	return pg.Conn.Query("SELECT config FROM alerts")
+}
+
+func (pg *PostgresDB) SaveRule(name string, config []byte) error {
+	_, err := pg.Conn.Exec(
+		`INSERT INTO rules (name, config, updated_at) VALUES ($1, $2, CURRENT_TIMESTAMP)
+		ON CONFLICT (name) DO UPDATE SET config = EXCLUDED.config, updated_at = EXCLUDED.updated_at`,
+		name, config,
+	)
+	return err
+}
+
+func (pg *PostgresDB) DeleteRule(name string) error {
+	_, err := pg.Conn.Exec("DELETE FROM rules WHERE name = $1", name)
+	return err
+}
+
+func (pg *PostgresDB) GetRules() (*sql.Rows, error) {
+	return pg.Conn.Query("SELECT config FROM rules")
+}
+
+func (pg *PostgresDB) SaveWebhook(id string, config []byte) error {
+	_, err := pg.Conn.Exec(
+		`INSERT INTO webhooks (id, config, updated_at) VALUES ($1, $2, CURRENT_TIMESTAMP)
+		ON CONFLICT (id) DO UPDATE SET config = EXCLUDED.config, updated_at = EXCLUDED.updated_at`,
+		id, config,
+	)
+	return err
+}
+
+// DeleteWebhook removes a webhook along with its queued and dead deliveries.
+func (pg *PostgresDB) DeleteWebhook(id string) error {
+	if _, err := pg.Conn.Exec("DELETE FROM webhook_deliveries WHERE webhook_id = $1", id); err != nil {
+		return err
+	}
+	_, err := pg.Conn.Exec("DELETE FROM webhooks WHERE id = $1", id)
+	return err
+}
+
+func (pg *PostgresDB) GetWebhooks() (*sql.Rows, error) {
+	return pg.Conn.Query("SELECT config FROM webhooks")
+}
+
+// Webhook delivery statuses.
+const (
+	DeliveryPending = "pending"
+	DeliveryDead    = "dead"
+)
+
+// EnqueueDelivery queues a payload for delivery. The payload is stored as
+// text so it is sent byte-for-byte as it was signed.
+func (pg *PostgresDB) EnqueueDelivery(webhookID, eventID, eventType string, payload []byte) error {
+	_, err := pg.Conn.Exec(
+		"INSERT INTO webhook_deliveries (webhook_id, event_id, event_type, payload) VALUES ($1, $2, $3, $4)",
+		webhookID, eventID, eventType, string(payload),
+	)
+	return err
+}
+
+// GetDueDeliveries returns pending deliveries whose next attempt is due, oldest first.
+func (pg *PostgresDB) GetDueDeliveries(limit int) (*sql.Rows, error) {
+	return pg.Conn.Query(
+		`SELECT id, webhook_id, event_id, event_type, payload, attempts FROM webhook_deliveries
+		WHERE status = $1 AND next_attempt_at <= CURRENT_TIMESTAMP
+		ORDER BY next_attempt_at, id LIMIT $2`,
+		DeliveryPending, limit,
+	)
+}
+
+func (pg *PostgresDB) CompleteDelivery(id int64) error {
+	_, err := pg.Conn.Exec("DELETE FROM webhook_deliveries WHERE id = $1", id)
+	return err
+}
+
+// RetryDelivery records a failed attempt and schedules the next one after delay.
+func (pg *PostgresDB) RetryDelivery(id int64, attempts int, delay time.Duration, lastError string) error {
+	_, err := pg.Conn.Exec(
+		`UPDATE webhook_deliveries SET attempts = $2, last_error = $3,
+		next_attempt_at = CURRENT_TIMESTAMP + $4 * INTERVAL '1 millisecond' WHERE id = $1`,
+		id, attempts, lastError, delay.Milliseconds(),
+	)
+	return err
+}
+
+func (pg *PostgresDB) DeadLetterDelivery(id int64, attempts int, lastError string) error {
+	_, err := pg.Conn.Exec(
+		"UPDATE webhook_deliveries SET status = $2, attempts = $3, last_error = $4 WHERE id = $1",
+		id, DeliveryDead, attempts, lastError,
+	)
+	return err
+}
+
+// GetDeadDeliveries lists dead-lettered deliveries, newest first. An empty
+// webhookID lists them for every webhook.
+func (pg *PostgresDB) GetDeadDeliveries(webhookID string, limit int) (*sql.Rows, error) {
+	return pg.Conn.Query(
+		`SELECT id, webhook_id, event_id, event_type, attempts, COALESCE(last_error, ''), created_at FROM webhook_deliveries
+		WHERE status = $1 AND ($2 = '' OR webhook_id = $2)
+		ORDER BY id DESC LIMIT $3`,
+		DeliveryDead, webhookID, limit,
+	)
+}
+
+// RequeueDelivery moves a dead-lettered delivery back onto the queue with
+// its attempts reset. It reports whether such a delivery existed.
+func (pg *PostgresDB) RequeueDelivery(id int64) (bool, error) {
+	res, err := pg.Conn.Exec(
+		`UPDATE webhook_deliveries SET status = $2, attempts = 0, next_attempt_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND status = $3`,
+		id, DeliveryPending, DeliveryDead,
+	)
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
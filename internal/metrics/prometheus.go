@@ -18,9 +18,70 @@ var (
 
 	AnomaliesDetected = promauto.NewCounterVec(prometheus.CounterOpts{
 		Name: "stocktrader_anomalies_total",
-		Help: "Total number of anomalies detected",
+		Help: "Total number of anomaly episodes opened",
+	}, []string{"symbol", "type", "detector"})
+
+	AnomalyEvents = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "stocktrader_anomaly_events_total",
+		Help: "Total number of published anomaly episode events",
+	}, []string{"type", "status", "severity"})
+
+	AnomalyLabels = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "stocktrader_anomaly_labels_total",
+		Help: "Total number of feedback labels applied to anomalies",
+	}, []string{"detector", "symbol", "label"})
+
+	DetectorPrecision = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "stocktrader_detector_precision_ratio",
+		Help: "Share of labelled anomalies marked useful, per detector and symbol",
+	}, []string{"detector", "symbol"})
+
+	AnomaliesSuppressed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "stocktrader_anomalies_suppressed_total",
+		Help: "Total number of findings dropped because their detector was auto-suppressed",
+	}, []string{"detector", "symbol"})
+
+	AlertsTriggered = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "stocktrader_alerts_triggered_total",
+		Help: "Total number of user price alerts triggered",
+	}, []string{"symbol", "condition"})
+
+	WebhookDeliveries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "stocktrader_webhook_deliveries_total",
+		Help: "Total number of webhook delivery attempts by result",
+	}, []string{"webhook", "result"})
+
+	WebhookLatency = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "stocktrader_webhook_delivery_seconds",
+		Help:    "Latency of webhook delivery attempts",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"webhook"})
+
+	EmailsSent = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "stocktrader_emails_total",
+		Help: "Total number of notification emails by result",
+	}, []string{"result"})
+
+	EmailEvents = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "stocktrader_email_events_total",
+		Help: "Total number of events carried in notification emails by result",
+	}, []string{"result"})
+
+	AlertmanagerAlerts = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "stocktrader_alertmanager_alerts_total",
+		Help: "Total number of alerts posted to Alertmanager by result",
+	}, []string{"result"})
+
+	BandEvents = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "stocktrader_band_events_total",
+		Help: "Total number of limit-up/limit-down band warnings and breaches",
 	}, []string{"symbol", "type"})
 
+	BandUsage = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "stocktrader_band_usage_ratio",
+		Help: "Signed share of the price band used, ±1 at the band",
+	}, []string{"symbol"})
+
 	DatabaseLatency = promauto.NewHistogram(prometheus.HistogramOpts{
 		Name:    "stocktrader_db_latency_seconds",
 		Help:    "Latency of database operations",
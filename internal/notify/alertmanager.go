@@ -0,0 +1,265 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Fahadada-code/StockTrader/internal/analytics"
+)
+
+// AlertmanagerAlert is an alert in the Alertmanager v2 API format.
+type AlertmanagerAlert struct {
+	Labels       map[string]string `json:"labels"`
+	Annotations  map[string]string `json:"annotations"`
+	StartsAt     time.Time         `json:"startsAt"`
+	EndsAt       time.Time         `json:"endsAt"`
+	GeneratorURL string            `json:"generatorURL,omitempty"`
+}
+
+// AlertmanagerNotifier posts anomaly episodes and triggered price alerts to
+// an Alertmanager. An episode fires from its start until it resolves; open
+// episodes are re-sent every ResendInterval with an endsAt a few intervals
+// ahead, so Alertmanager resolves them on its own if we stop sending. A
+// price alert is a one-off and fires for AlertDuration.
+type AlertmanagerNotifier struct {
+	ResendInterval time.Duration
+	AlertDuration  time.Duration
+	GeneratorURL   string
+
+	// OnSend, if set, is called after every post with the number of alerts
+	// it carried.
+	OnSend func(alerts int, err error)
+
+	endpoint   string
+	client     *http.Client
+	episodes   map[string]AlertmanagerAlert // firing episodes by episode ID
+	pending    []AlertmanagerAlert
+	lastResend time.Time
+	mu         sync.Mutex
+}
+
+// maxPendingAlerts bounds the queue while Alertmanager is unreachable.
+const maxPendingAlerts = 1000
+
+// NewAlertmanagerNotifier posts to the v2 alerts endpoint of the
+// Alertmanager at baseURL.
+func NewAlertmanagerNotifier(baseURL string) (*AlertmanagerNotifier, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("url must be an absolute http or https URL")
+	}
+	if !strings.HasSuffix(u.Path, "/api/v2/alerts") {
+		u.Path = strings.TrimSuffix(u.Path, "/") + "/api/v2/alerts"
+	}
+	return &AlertmanagerNotifier{
+		ResendInterval: time.Minute,
+		AlertDuration:  5 * time.Minute,
+		endpoint:       u.String(),
+		client:         &http.Client{Timeout: 10 * time.Second},
+		episodes:       make(map[string]AlertmanagerAlert),
+		lastResend:     time.Now(),
+	}, nil
+}
+
+func (n *AlertmanagerNotifier) Name() string { return "alertmanager" }
+
+// Notify turns anomaly and alert events into Alertmanager alerts; other
+// events are ignored.
+func (n *AlertmanagerNotifier) Notify(e Event) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	switch data := e.Data.(type) {
+	case analytics.Anomaly:
+		n.episode(data, e.Time)
+	case analytics.AlertTrigger:
+		n.queue(AlertmanagerAlert{
+			Labels: map[string]string{
+				"alertname": "StockTraderPriceAlert",
+				"symbol":    data.Alert.Symbol,
+				"type":      data.Alert.Condition,
+				"severity":  string(analytics.SeverityWarning),
+				"user":      data.Alert.User,
+				"alert_id":  data.Alert.ID,
+			},
+			Annotations: map[string]string{
+				"summary":     fmt.Sprintf("%s price alert", data.Alert.Symbol),
+				"description": data.Message,
+			},
+			StartsAt:     data.Time,
+			EndsAt:       data.Time.Add(n.AlertDuration),
+			GeneratorURL: n.GeneratorURL,
+		})
+	}
+}
+
+// episode tracks the alert for an anomaly episode. Labels must stay the same
+// for Alertmanager to treat updates as the same alert, so an escalation that
+// raises the severity ends the old alert and starts a new one, and the
+// resolve event reuses the labels the episode last fired with.
+func (n *AlertmanagerNotifier) episode(a analytics.Anomaly, now time.Time) {
+	current, firing := n.episodes[a.EpisodeID]
+	if a.Status == analytics.StatusResolved {
+		if !firing {
+			return
+		}
+		current.EndsAt = now
+		if a.EndedAt != nil {
+			current.EndsAt = *a.EndedAt
+		}
+		delete(n.episodes, a.EpisodeID)
+		n.queue(current)
+		return
+	}
+
+	alert := AlertmanagerAlert{
+		Labels: map[string]string{
+			"alertname": "StockTraderAnomaly",
+			"symbol":    a.Symbol,
+			"type":      a.Type,
+			"severity":  string(a.Severity),
+			"detector":  a.Detector,
+			"episode":   a.EpisodeID,
+		},
+		Annotations: map[string]string{
+			"summary":     fmt.Sprintf("%s %s", a.Symbol, strings.ReplaceAll(a.Type, "_", " ")),
+			"description": a.Details,
+			"magnitude":   fmt.Sprintf("%.4g", a.Magnitude),
+		},
+		StartsAt:     a.StartedAt,
+		EndsAt:       now.Add(4 * n.ResendInterval),
+		GeneratorURL: n.GeneratorURL,
+	}
+	if firing && current.Labels["severity"] != alert.Labels["severity"] {
+		current.EndsAt = now
+		n.queue(current)
+		alert.StartsAt = now
+	}
+	n.episodes[a.EpisodeID] = alert
+	n.queue(alert)
+}
+
+// queue adds an alert to the next post. A firing alert replaces a pending
+// firing copy of itself. When the queue is full, firing alerts are dropped
+// before resolutions: a lost resend is repeated on the next resend, but a lost
+// resolution leaves the alert firing in Alertmanager until endsAt passes.
+func (n *AlertmanagerNotifier) queue(alert AlertmanagerAlert) {
+	now := time.Now()
+	if alert.EndsAt.After(now) {
+		key := labelKey(alert.Labels)
+		for i, p := range n.pending {
+			if p.EndsAt.After(now) && labelKey(p.Labels) == key {
+				n.pending[i] = alert
+				return
+			}
+		}
+	}
+	if len(n.pending) >= maxPendingAlerts {
+		drop := 0
+		for i, p := range n.pending {
+			if p.EndsAt.After(now) {
+				drop = i
+				break
+			}
+		}
+		n.pending = append(n.pending[:drop], n.pending[drop+1:]...)
+	}
+	n.pending = append(n.pending, alert)
+}
+
+// labelKey identifies an alert the way Alertmanager does, by its label set.
+func labelKey(labels map[string]string) string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var b strings.Builder
+	for _, name := range names {
+		b.WriteString(name)
+		b.WriteByte('=')
+		b.WriteString(labels[name])
+		b.WriteByte(0)
+	}
+	return b.String()
+}
+
+// Run posts queued alerts every interval and re-sends firing episodes every
+// ResendInterval, until ctx is cancelled.
+func (n *AlertmanagerNotifier) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			n.flush(ctx, now)
+		}
+	}
+}
+
+func (n *AlertmanagerNotifier) flush(ctx context.Context, now time.Time) {
+	n.mu.Lock()
+	if now.Sub(n.lastResend) >= n.ResendInterval {
+		n.lastResend = now
+		for id, alert := range n.episodes {
+			alert.EndsAt = now.Add(4 * n.ResendInterval)
+			n.episodes[id] = alert
+			n.queue(alert)
+		}
+	}
+	batch := n.pending
+	n.pending = nil
+	n.mu.Unlock()
+	if len(batch) == 0 {
+		return
+	}
+
+	err := n.post(ctx, batch)
+	if err != nil {
+		log.Printf("Warning: failed to post %d alerts to Alertmanager: %v", len(batch), err)
+		// Keep the batch for the next flush; anything newer goes after it
+		n.mu.Lock()
+		newer := n.pending
+		n.pending = nil
+		for _, alert := range append(batch, newer...) {
+			n.queue(alert)
+		}
+		n.mu.Unlock()
+	}
+	if n.OnSend != nil {
+		n.OnSend(len(batch), err)
+	}
+}
+
+func (n *AlertmanagerNotifier) post(ctx context.Context, alerts []AlertmanagerAlert) error {
+	payload, err := json.Marshal(alerts)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("alertmanager responded %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,207 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Fahadada-code/StockTrader/internal/analytics"
+)
+
+// alertmanagerStub records every batch posted to /api/v2/alerts.
+type alertmanagerStub struct {
+	*httptest.Server
+	mu      sync.Mutex
+	status  int
+	batches [][]AlertmanagerAlert
+}
+
+func newAlertmanagerStub(t *testing.T) *alertmanagerStub {
+	s := &alertmanagerStub{status: http.StatusOK}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/api/v2/alerts" {
+			http.NotFound(w, r)
+			return
+		}
+		var batch []AlertmanagerAlert
+		if err := json.NewDecoder(r.Body).Decode(&batch); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.status != http.StatusOK {
+			w.WriteHeader(s.status)
+			return
+		}
+		s.batches = append(s.batches, batch)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *alertmanagerStub) last() []AlertmanagerAlert {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.batches) == 0 {
+		return nil
+	}
+	return s.batches[len(s.batches)-1]
+}
+
+func episodeEvent(a analytics.Anomaly) Event {
+	return NewEvent("anomaly", a.Symbol, a)
+}
+
+func TestAlertmanagerEpisodeLifecycle(t *testing.T) {
+	stub := newAlertmanagerStub(t)
+	n, err := NewAlertmanagerNotifier(stub.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	started := time.Now().Add(-time.Minute).UTC().Truncate(time.Second)
+	a := analytics.Anomaly{
+		Symbol:    "AAPL",
+		Type:      "price_jump",
+		Detector:  "price_jump",
+		Severity:  analytics.SeverityWarning,
+		Status:    analytics.StatusOpen,
+		EpisodeID: "ep1",
+		StartedAt: started,
+		Details:   "Price jumped 3%.",
+	}
+
+	// Open: fires from the episode start with endsAt ahead of now
+	n.Notify(episodeEvent(a))
+	n.flush(ctx, time.Now())
+	batch := stub.last()
+	if len(batch) != 1 {
+		t.Fatalf("open posted %d alerts, want 1", len(batch))
+	}
+	open := batch[0]
+	for name, want := range map[string]string{"alertname": "StockTraderAnomaly", "symbol": "AAPL", "type": "price_jump", "severity": "warning", "episode": "ep1"} {
+		if open.Labels[name] != want {
+			t.Errorf("label %s = %q, want %q", name, open.Labels[name], want)
+		}
+	}
+	if !open.StartsAt.Equal(started) {
+		t.Errorf("startsAt = %v, want the episode start %v", open.StartsAt, started)
+	}
+	if !open.EndsAt.After(time.Now()) {
+		t.Errorf("endsAt = %v, want it in the future while firing", open.EndsAt)
+	}
+
+	// Resend: same labels and start, endsAt pushed out
+	resendAt := time.Now().Add(n.ResendInterval)
+	n.flush(ctx, resendAt)
+	batch = stub.last()
+	if len(batch) != 1 || labelKey(batch[0].Labels) != labelKey(open.Labels) {
+		t.Fatalf("resend = %+v, want the open alert again", batch)
+	}
+	if !batch[0].StartsAt.Equal(started) || !batch[0].EndsAt.Equal(resendAt.Add(4*n.ResendInterval)) {
+		t.Errorf("resend startsAt/endsAt = %v/%v", batch[0].StartsAt, batch[0].EndsAt)
+	}
+
+	// Escalation: the warning alert ends and a critical one starts
+	a.Status, a.Severity = analytics.StatusEscalated, analytics.SeverityCritical
+	escalated := episodeEvent(a)
+	n.Notify(escalated)
+	n.flush(ctx, resendAt.Add(time.Second))
+	batch = stub.last()
+	if len(batch) != 2 {
+		t.Fatalf("escalation posted %d alerts, want 2", len(batch))
+	}
+	if batch[0].Labels["severity"] != "warning" || !batch[0].EndsAt.Equal(escalated.Time) {
+		t.Errorf("escalation should end the warning alert, got %+v", batch[0])
+	}
+	if batch[1].Labels["severity"] != "critical" || !batch[1].StartsAt.Equal(escalated.Time) || !batch[1].EndsAt.After(time.Now()) {
+		t.Errorf("escalation should start a critical alert, got %+v", batch[1])
+	}
+
+	// Resolve: reuses the critical labels even though the event says info
+	ended := time.Now().UTC()
+	a.Status, a.Severity, a.EndedAt = analytics.StatusResolved, analytics.SeverityInfo, &ended
+	n.Notify(episodeEvent(a))
+	n.flush(ctx, resendAt.Add(2*time.Second))
+	batch = stub.last()
+	if len(batch) != 1 || batch[0].Labels["severity"] != "critical" || !batch[0].EndsAt.Equal(ended) {
+		t.Fatalf("resolve = %+v, want the critical alert ending at %v", batch, ended)
+	}
+
+	// Resolved episodes are no longer resent
+	posts := len(stub.batches)
+	n.flush(ctx, resendAt.Add(2*n.ResendInterval))
+	if len(stub.batches) != posts {
+		t.Errorf("resolved episode was resent: %+v", stub.last())
+	}
+}
+
+func TestAlertmanagerKeepsResolvesWhenFull(t *testing.T) {
+	stub := newAlertmanagerStub(t)
+	stub.status = http.StatusServiceUnavailable
+	n, _ := NewAlertmanagerNotifier(stub.URL)
+	ctx := context.Background()
+
+	open := func(id string) analytics.Anomaly {
+		return analytics.Anomaly{Symbol: "AAPL", Type: "price_jump", Severity: analytics.SeverityWarning, Status: analytics.StatusOpen, EpisodeID: id, StartedAt: time.Now()}
+	}
+	// One episode opens and resolves while Alertmanager is down...
+	first := open("first")
+	n.Notify(episodeEvent(first))
+	ended := time.Now()
+	first.Status, first.EndedAt = analytics.StatusResolved, &ended
+	n.Notify(episodeEvent(first))
+	n.flush(ctx, time.Now())
+
+	// ...then enough other episodes fire to overflow the queue
+	for i := 0; i < maxPendingAlerts+50; i++ {
+		n.Notify(episodeEvent(open(NewEvent("", "", nil).ID)))
+	}
+	if len(n.pending) != maxPendingAlerts {
+		t.Fatalf("pending = %d, want %d", len(n.pending), maxPendingAlerts)
+	}
+
+	stub.mu.Lock()
+	stub.status = http.StatusOK
+	stub.mu.Unlock()
+	n.flush(ctx, time.Now())
+	found := false
+	for _, alert := range stub.last() {
+		if alert.Labels["episode"] == "first" && alert.EndsAt.Equal(ended) {
+			found = true
+		}
+	}
+	if !found {
+		t.Error("the resolve for episode first was dropped from a full queue")
+	}
+}
+
+func TestAlertmanagerPriceAlert(t *testing.T) {
+	stub := newAlertmanagerStub(t)
+	n, _ := NewAlertmanagerNotifier(stub.URL + "/api/v2/alerts")
+	triggered := time.Now().UTC()
+	n.Notify(NewEvent("alert", "MSFT", analytics.AlertTrigger{
+		Alert:   analytics.Alert{ID: "a1", User: "alice", Symbol: "MSFT", Condition: analytics.AlertCrossesAbove},
+		Message: "MSFT crossed above 400.00 at 401.00.",
+		Time:    triggered,
+	}))
+	n.Notify(NewEvent("test", "", nil)) // ignored
+	n.flush(context.Background(), time.Now())
+
+	batch := stub.last()
+	if len(batch) != 1 {
+		t.Fatalf("posted %d alerts, want 1", len(batch))
+	}
+	alert := batch[0]
+	if alert.Labels["alertname"] != "StockTraderPriceAlert" || alert.Labels["user"] != "alice" || alert.Labels["type"] != "crosses_above" {
+		t.Errorf("labels = %v", alert.Labels)
+	}
+	if !alert.StartsAt.Equal(triggered) || !alert.EndsAt.Equal(triggered.Add(n.AlertDuration)) {
+		t.Errorf("startsAt/endsAt = %v/%v", alert.StartsAt, alert.EndsAt)
+	}
+}
@@ -0,0 +1,427 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"log"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// SMTP connection security modes.
+const (
+	SMTPStartTLS = "starttls" // upgrade with STARTTLS, failing if the server doesn't offer it
+	SMTPTLS      = "tls"      // implicit TLS, usually port 465
+	SMTPPlain    = "none"     // no encryption, e.g. a local test server
+)
+
+var ErrRecipientNotFound = errors.New("email recipient not found")
+
+type SMTPConfig struct {
+	Host     string
+	Port     string
+	Username string // empty disables authentication
+	Password string
+	From     string
+	Security string
+}
+
+// Recipient receives events by email. Events owned by a user, such as
+// alerts, only go to that user; everything else goes to every recipient.
+type Recipient struct {
+	User    string `json:"user"`
+	Address string `json:"address"`
+}
+
+// EmailNotifier emails events through an SMTP relay. Each address gets at
+// most one email per Interval: events arriving in between are queued and
+// sent together as a digest of up to MaxDigest events.
+type EmailNotifier struct {
+	Interval  time.Duration
+	MaxDigest int
+
+	// OnSend, if set, is called after every email with the number of events
+	// it carried and whether it was sent.
+	OnSend func(recipient string, events int, err error)
+
+	config     SMTPConfig
+	recipients []Recipient
+	text       *template.Template
+	html       *htmltemplate.Template
+	queues     map[string]*emailQueue // by address
+	mu         sync.Mutex
+}
+
+type emailQueue struct {
+	events   []Event
+	dropped  int
+	lastSent time.Time
+}
+
+// EmailData is what the email templates are executed with.
+type EmailData struct {
+	Recipient Recipient
+	Subject   string
+	Events    []Event
+	Dropped   int // events left out of a full digest
+}
+
+const defaultTextTemplate = `{{if gt (len .Events) 1}}{{len .Events}} StockTrader events{{else}}StockTrader event{{end}} for {{.Recipient.User}}
+
+{{range .Events}}{{.Time.Format "2006-01-02 15:04:05 MST"}}  {{.Symbol}}  {{.Type}}{{if .Severity}} ({{.Severity}}){{end}}
+  {{.Message}}
+
+{{end}}{{if .Dropped}}{{.Dropped}} more events were left out of this digest.
+{{end}}`
+
+const defaultHTMLTemplate = `<html><body style="font-family: sans-serif">
+<h3>{{if gt (len .Events) 1}}{{len .Events}} StockTrader events{{else}}StockTrader event{{end}}</h3>
+<table cellpadding="4" style="border-collapse: collapse">
+<tr><th align="left">Time</th><th align="left">Symbol</th><th align="left">Event</th><th align="left">Details</th></tr>
+{{range .Events}}<tr>
+<td>{{.Time.Format "15:04:05 MST"}}</td>
+<td><b>{{.Symbol}}</b></td>
+<td>{{.Type}}{{if .Severity}} ({{.Severity}}){{end}}</td>
+<td>{{.Message}}</td>
+</tr>
+{{end}}</table>
+{{if .Dropped}}<p>{{.Dropped}} more events were left out of this digest.</p>{{end}}
+</body></html>`
+
+// NewEmailNotifier validates the SMTP settings and parses the body
+// templates. Empty template paths use the built-in templates.
+func NewEmailNotifier(config SMTPConfig, recipients []Recipient, textPath, htmlPath string) (*EmailNotifier, error) {
+	if config.Host == "" || config.From == "" {
+		return nil, fmt.Errorf("an SMTP host and from address are required")
+	}
+	if config.Port == "" {
+		config.Port = "587"
+	}
+	switch config.Security {
+	case "":
+		config.Security = SMTPStartTLS
+	case SMTPStartTLS, SMTPTLS, SMTPPlain:
+	default:
+		return nil, fmt.Errorf("unknown SMTP security mode %q", config.Security)
+	}
+	// A user may have several addresses, but each address is listed once
+	seen := make(map[string]bool)
+	for _, r := range recipients {
+		if r.User == "" || !strings.Contains(r.Address, "@") {
+			return nil, fmt.Errorf("invalid recipient %q", r.User+"="+r.Address)
+		}
+		if seen[strings.ToLower(r.Address)] {
+			return nil, fmt.Errorf("recipient address %s is listed twice", r.Address)
+		}
+		seen[strings.ToLower(r.Address)] = true
+	}
+
+	textSrc, htmlSrc := defaultTextTemplate, defaultHTMLTemplate
+	if textPath != "" {
+		data, err := os.ReadFile(textPath)
+		if err != nil {
+			return nil, err
+		}
+		textSrc = string(data)
+	}
+	if htmlPath != "" {
+		data, err := os.ReadFile(htmlPath)
+		if err != nil {
+			return nil, err
+		}
+		htmlSrc = string(data)
+	}
+	text, err := template.New("text").Parse(textSrc)
+	if err != nil {
+		return nil, fmt.Errorf("text template: %w", err)
+	}
+	html, err := htmltemplate.New("html").Parse(htmlSrc)
+	if err != nil {
+		return nil, fmt.Errorf("html template: %w", err)
+	}
+
+	return &EmailNotifier{
+		Interval:   5 * time.Minute,
+		MaxDigest:  50,
+		config:     config,
+		recipients: recipients,
+		text:       text,
+		html:       html,
+		queues:     make(map[string]*emailQueue),
+	}, nil
+}
+
+func (n *EmailNotifier) Name() string { return "email" }
+
+// Notify queues the event for its recipients; Run sends the emails.
+func (n *EmailNotifier) Notify(e Event) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for _, r := range n.recipients {
+		if e.User != "" && e.User != r.User {
+			continue
+		}
+		q, ok := n.queues[r.Address]
+		if !ok {
+			q = &emailQueue{}
+			n.queues[r.Address] = q
+		}
+		if len(q.events) >= n.MaxDigest {
+			q.dropped++
+			continue
+		}
+		q.events = append(q.events, e)
+	}
+}
+
+// Run sends queued events every interval to the recipients whose rate limit
+// has expired, until ctx is cancelled.
+func (n *EmailNotifier) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n.flush(time.Now())
+		}
+	}
+}
+
+func (n *EmailNotifier) flush(now time.Time) {
+	type batch struct {
+		recipient Recipient
+		events    []Event
+		dropped   int
+	}
+	var due []batch
+	n.mu.Lock()
+	for _, r := range n.recipients {
+		q, ok := n.queues[r.Address]
+		if !ok || len(q.events) == 0 || now.Sub(q.lastSent) < n.Interval {
+			continue
+		}
+		due = append(due, batch{r, q.events, q.dropped})
+		q.events, q.dropped = nil, 0
+		q.lastSent = now
+	}
+	n.mu.Unlock()
+
+	for _, b := range due {
+		err := n.send(b.recipient, b.events, b.dropped)
+		if err != nil {
+			log.Printf("Warning: failed to email %d events to %s: %v", len(b.events), b.recipient.Address, err)
+			n.requeue(b.recipient.Address, b.events)
+		}
+		if n.OnSend != nil {
+			n.OnSend(b.recipient.User, len(b.events), err)
+		}
+	}
+}
+
+// requeue puts the events of a failed email back in front of the queue so
+// they go out with the next digest.
+func (n *EmailNotifier) requeue(address string, events []Event) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	q := n.queues[address]
+	merged := append(events, q.events...)
+	if len(merged) > n.MaxDigest {
+		q.dropped += len(merged) - n.MaxDigest
+		merged = merged[:n.MaxDigest]
+	}
+	q.events = merged
+}
+
+// Test emails a test event to every address of a user straight away,
+// ignoring the rate limit.
+func (n *EmailNotifier) Test(user string) error {
+	found := false
+	for _, r := range n.recipients {
+		if r.User != user {
+			continue
+		}
+		found = true
+		e := NewEvent("test", "", nil)
+		e.Message = "Test email from StockTrader."
+		if err := n.send(r, []Event{e}, 0); err != nil {
+			return err
+		}
+	}
+	if !found {
+		return ErrRecipientNotFound
+	}
+	return nil
+}
+
+// Recipients lists the configured recipients by user.
+func (n *EmailNotifier) Recipients() []Recipient {
+	out := append([]Recipient(nil), n.recipients...)
+	sort.Slice(out, func(i, j int) bool { return out[i].User < out[j].User })
+	return out
+}
+
+func (n *EmailNotifier) send(r Recipient, events []Event, dropped int) error {
+	data := EmailData{Recipient: r, Subject: subject(events), Events: events, Dropped: dropped}
+	var text, html bytes.Buffer
+	if err := n.text.Execute(&text, data); err != nil {
+		return err
+	}
+	if err := n.html.Execute(&html, data); err != nil {
+		return err
+	}
+	msg, err := buildMessage(n.config.From, r.Address, data.Subject, text.Bytes(), html.Bytes())
+	if err != nil {
+		return err
+	}
+	return n.deliver(r.Address, msg)
+}
+
+func subject(events []Event) string {
+	if len(events) == 1 {
+		e := events[0]
+		if e.Symbol == "" {
+			return "[StockTrader] " + e.Type
+		}
+		return fmt.Sprintf("[StockTrader] %s %s", e.Symbol, e.Type)
+	}
+	seen := make(map[string]bool)
+	var symbols []string
+	for _, e := range events {
+		if e.Symbol != "" && !seen[e.Symbol] {
+			seen[e.Symbol] = true
+			symbols = append(symbols, e.Symbol)
+		}
+	}
+	sort.Strings(symbols)
+	if len(symbols) > 5 {
+		symbols = append(symbols[:5], "...")
+	}
+	return fmt.Sprintf("[StockTrader] %d events: %s", len(events), strings.Join(symbols, ", "))
+}
+
+// buildMessage assembles a multipart/alternative email with quoted-printable
+// text and HTML parts.
+func buildMessage(from, to, subject string, text, html []byte) ([]byte, error) {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for _, part := range []struct {
+		contentType string
+		content     []byte
+	}{{"text/plain", text}, {"text/html", html}} {
+		w, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType + "; charset=utf-8"},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		qp := quotedprintable.NewWriter(w)
+		qp.Write(part.content)
+		qp.Close()
+	}
+	mw.Close()
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", from)
+	fmt.Fprintf(&msg, "To: %s\r\n", to)
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&msg, "Message-ID: <%s@stocktrader>\r\n", newID())
+	fmt.Fprintf(&msg, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&msg, "Content-Type: multipart/alternative; boundary=%s\r\n\r\n", mw.Boundary())
+	msg.Write(body.Bytes())
+	return msg.Bytes(), nil
+}
+
+// deliver sends msg over a fresh SMTP connection. net/smtp.SendMail has no
+// timeout and can't do implicit TLS, so the session is driven by hand.
+func (n *EmailNotifier) deliver(to string, msg []byte) error {
+	addr := net.JoinHostPort(n.config.Host, n.config.Port)
+	tlsConfig := &tls.Config{ServerName: n.config.Host}
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+
+	var conn net.Conn
+	var err error
+	if n.config.Security == SMTPTLS {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Now().Add(30 * time.Second))
+
+	c, err := smtp.NewClient(conn, n.config.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+	// Plaintext is only ever used when asked for, so a server (or anyone in
+	// between) that doesn't offer STARTTLS can't downgrade the session
+	if n.config.Security == SMTPStartTLS {
+		if ok, _ := c.Extension("STARTTLS"); !ok {
+			return fmt.Errorf("%s does not offer STARTTLS; set the security mode to %q to send unencrypted", n.config.Host, SMTPPlain)
+		}
+		if err := c.StartTLS(tlsConfig); err != nil {
+			return err
+		}
+	}
+	if n.config.Username != "" {
+		if err := c.Auth(smtp.PlainAuth("", n.config.Username, n.config.Password, n.config.Host)); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(n.config.From); err != nil {
+		return err
+	}
+	if err := c.Rcpt(to); err != nil {
+		return err
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// ParseRecipients parses a comma-separated list of user=address pairs. A
+// bare address is its own user.
+func ParseRecipients(s string) []Recipient {
+	var out []Recipient
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		user, address, ok := strings.Cut(item, "=")
+		if !ok {
+			address = user
+		}
+		out = append(out, Recipient{User: strings.TrimSpace(user), Address: strings.TrimSpace(address)})
+	}
+	return out
+}
@@ -0,0 +1,214 @@
+package notify
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type sentMail struct {
+	to   string
+	data string
+}
+
+// smtpStub is a minimal SMTP server that accepts every message and records
+// it. It never offers STARTTLS.
+type smtpStub struct {
+	ln   net.Listener
+	mu   sync.Mutex
+	mail []sentMail
+}
+
+func newSMTPStub(t *testing.T) *smtpStub {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &smtpStub{ln: ln}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	t.Cleanup(func() { ln.Close() })
+	return s
+}
+
+func (s *smtpStub) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+	reply("220 stub ready")
+	var to string
+	var data strings.Builder
+	inData := false
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		if inData {
+			if line == ".\r\n" {
+				inData = false
+				s.mu.Lock()
+				s.mail = append(s.mail, sentMail{to: to, data: data.String()})
+				s.mu.Unlock()
+				data.Reset()
+				reply("250 queued")
+				continue
+			}
+			data.WriteString(line)
+			continue
+		}
+		cmd := strings.ToUpper(line)
+		switch {
+		case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+			reply("250 stub")
+		case strings.HasPrefix(cmd, "RCPT TO:"):
+			to = strings.Trim(strings.TrimSpace(line[len("RCPT TO:"):]), "<>")
+			reply("250 ok")
+		case strings.HasPrefix(cmd, "DATA"):
+			inData = true
+			reply("354 go ahead")
+		case strings.HasPrefix(cmd, "QUIT"):
+			reply("221 bye")
+			return
+		default:
+			reply("250 ok")
+		}
+	}
+}
+
+func (s *smtpStub) sent() []sentMail {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]sentMail(nil), s.mail...)
+}
+
+func newTestEmailNotifier(t *testing.T, stub *smtpStub, security, recipients string) *EmailNotifier {
+	host, port, _ := net.SplitHostPort(stub.ln.Addr().String())
+	n, err := NewEmailNotifier(SMTPConfig{Host: host, Port: port, From: "alerts@stocktrader.test", Security: security}, ParseRecipients(recipients), "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func anomalyEvent(symbol, message string) Event {
+	e := NewEvent("anomaly", symbol, nil)
+	e.Message = message
+	return e
+}
+
+func TestEmailDigestAndRateLimit(t *testing.T) {
+	stub := newSMTPStub(t)
+	n := newTestEmailNotifier(t, stub, SMTPPlain, "desk=desk@example.test")
+	n.Interval = 5 * time.Minute
+	start := time.Now()
+
+	for _, symbol := range []string{"AAPL", "MSFT", "AAPL"} {
+		n.Notify(anomalyEvent(symbol, "Price jumped"))
+	}
+	n.flush(start)
+	mail := stub.sent()
+	if len(mail) != 1 {
+		t.Fatalf("sent %d emails, want one digest", len(mail))
+	}
+	if !strings.Contains(mail[0].data, "Subject: [StockTrader] 3 events: AAPL, MSFT") {
+		t.Errorf("digest subject missing from:\n%s", mail[0].data)
+	}
+	if !strings.Contains(mail[0].data, "multipart/alternative") {
+		t.Error("digest is not multipart/alternative")
+	}
+
+	// Within the interval events wait for the next digest
+	n.Notify(anomalyEvent("TSLA", "Volume spike"))
+	n.Notify(anomalyEvent("TSLA", "Volume spike again"))
+	n.flush(start.Add(time.Minute))
+	if got := len(stub.sent()); got != 1 {
+		t.Fatalf("sent %d emails inside the rate limit, want 1", got)
+	}
+	n.flush(start.Add(5 * time.Minute))
+	mail = stub.sent()
+	if len(mail) != 2 {
+		t.Fatalf("sent %d emails after the interval, want 2", len(mail))
+	}
+	if !strings.Contains(mail[1].data, "Subject: [StockTrader] 2 events: TSLA") {
+		t.Errorf("second digest subject missing from:\n%s", mail[1].data)
+	}
+}
+
+func TestEmailDigestCap(t *testing.T) {
+	stub := newSMTPStub(t)
+	n := newTestEmailNotifier(t, stub, SMTPPlain, "desk@example.test")
+	n.MaxDigest = 2
+	for i := 0; i < 5; i++ {
+		n.Notify(anomalyEvent("AAPL", "Price jumped"))
+	}
+	n.flush(time.Now())
+	mail := stub.sent()
+	if len(mail) != 1 {
+		t.Fatalf("sent %d emails, want 1", len(mail))
+	}
+	if !strings.Contains(mail[0].data, "3 more events were left out") {
+		t.Errorf("dropped count missing from:\n%s", mail[0].data)
+	}
+}
+
+func TestEmailPerAddressQueues(t *testing.T) {
+	stub := newSMTPStub(t)
+	n := newTestEmailNotifier(t, stub, SMTPPlain, "alice=a@example.test,alice=b@example.test,bob=bob@example.test")
+
+	n.Notify(anomalyEvent("AAPL", "Price jumped"))
+	alert := NewEvent("alert", "MSFT", nil)
+	alert.User = "alice"
+	alert.Message = "MSFT crossed above 400.00"
+	n.Notify(alert)
+	n.flush(time.Now())
+
+	counts := make(map[string]int)
+	for _, m := range stub.sent() {
+		counts[m.to]++
+		if m.to == "bob@example.test" && strings.Contains(m.data, "MSFT") {
+			t.Errorf("bob received alice's alert:\n%s", m.data)
+		}
+		if m.to != "bob@example.test" && !strings.Contains(m.data, "2 events") {
+			t.Errorf("%s should get both events:\n%s", m.to, m.data)
+		}
+	}
+	for _, addr := range []string{"a@example.test", "b@example.test", "bob@example.test"} {
+		if counts[addr] != 1 {
+			t.Errorf("%s received %d emails, want 1", addr, counts[addr])
+		}
+	}
+
+	if _, err := NewEmailNotifier(SMTPConfig{Host: "h", From: "f@x"}, ParseRecipients("a=x@y,b=x@y"), "", ""); err == nil {
+		t.Error("duplicate address accepted")
+	}
+}
+
+func TestEmailStartTLSRequired(t *testing.T) {
+	stub := newSMTPStub(t)
+	n := newTestEmailNotifier(t, stub, SMTPStartTLS, "desk@example.test")
+	err := n.Test("desk@example.test")
+	if err == nil || !strings.Contains(err.Error(), "STARTTLS") {
+		t.Fatalf("Test without STARTTLS = %v, want a STARTTLS error", err)
+	}
+	if got := len(stub.sent()); got != 0 {
+		t.Errorf("sent %d emails in plaintext, want none", got)
+	}
+
+	// A failed digest is kept for the next attempt
+	n.Notify(anomalyEvent("AAPL", "Price jumped"))
+	n.flush(time.Now())
+	if got := len(n.queues["desk@example.test"].events); got != 1 {
+		t.Errorf("%d events requeued after a failed send, want 1", got)
+	}
+}
@@ -0,0 +1,69 @@
+package notify
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// Event is something worth telling the outside world about, such as a
+// published anomaly or a triggered price alert.
+type Event struct {
+	ID       string      `json:"id"`
+	Type     string      `json:"type"` // "anomaly", "alert", "test"
+	Symbol   string      `json:"symbol"`
+	User     string      `json:"user,omitempty"` // owner of a per-user event such as an alert
+	Severity string      `json:"severity,omitempty"`
+	Message  string      `json:"message,omitempty"` // one-line human-readable summary
+	Time     time.Time   `json:"time"`
+	Data     interface{} `json:"data"`
+}
+
+func NewEvent(eventType, symbol string, data interface{}) Event {
+	return Event{ID: newID(), Type: eventType, Symbol: symbol, Time: time.Now().UTC(), Data: data}
+}
+
+// Notifier delivers events to one kind of destination. Notify must not block
+// on network I/O; notifiers queue work and deliver in the background.
+type Notifier interface {
+	Name() string
+	Notify(e Event)
+}
+
+// Hub fans every published event out to all registered notifiers.
+type Hub struct {
+	notifiers []Notifier
+	mu        sync.RWMutex
+}
+
+func NewHub(notifiers ...Notifier) *Hub {
+	return &Hub{notifiers: notifiers}
+}
+
+func (h *Hub) Add(n Notifier) {
+	h.mu.Lock()
+	h.notifiers = append(h.notifiers, n)
+	h.mu.Unlock()
+}
+
+func (h *Hub) Publish(e Event) {
+	h.mu.RLock()
+	notifiers := append([]Notifier(nil), h.notifiers...)
+	h.mu.RUnlock()
+	for _, n := range notifiers {
+		n.Notify(e)
+	}
+}
+
+func newID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func newSecret() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
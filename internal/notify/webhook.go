@@ -0,0 +1,506 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/Fahadada-code/StockTrader/internal/db"
+)
+
+// Delivery results reported to OnDelivery.
+const (
+	ResultDelivered = "delivered"
+	ResultRetry     = "retry"
+	ResultDead      = "dead"
+)
+
+var ErrWebhookNotFound = errors.New("webhook not found")
+
+// Webhook is an outbound subscription. Empty Symbols or EventTypes match
+// everything.
+type Webhook struct {
+	ID         string    `json:"id"`
+	URL        string    `json:"url"`
+	Secret     string    `json:"secret,omitempty"`
+	Symbols    []string  `json:"symbols,omitempty"`
+	EventTypes []string  `json:"event_types,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+func (w Webhook) matches(e Event) bool {
+	return (len(w.Symbols) == 0 || contains(w.Symbols, e.Symbol)) &&
+		(len(w.EventTypes) == 0 || contains(w.EventTypes, e.Type))
+}
+
+// DeadDelivery is a delivery that exhausted its retries.
+type DeadDelivery struct {
+	ID        int64     `json:"id"`
+	WebhookID string    `json:"webhook_id"`
+	EventID   string    `json:"event_id"`
+	EventType string    `json:"event_type"`
+	Attempts  int       `json:"attempts"`
+	LastError string    `json:"last_error"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type TestResult struct {
+	StatusCode int     `json:"status_code"`
+	LatencyMs  float64 `json:"latency_ms"`
+	Error      string  `json:"error,omitempty"`
+}
+
+// webhookStore is the part of the database the dispatcher uses.
+type webhookStore interface {
+	GetWebhooks() (*sql.Rows, error)
+	SaveWebhook(id string, config []byte) error
+	DeleteWebhook(id string) error
+	EnqueueDelivery(webhookID, eventID, eventType string, payload []byte) error
+	GetDueDeliveries(limit int) (*sql.Rows, error)
+	CompleteDelivery(id int64) error
+	RetryDelivery(id int64, attempts int, delay time.Duration, lastError string) error
+	DeadLetterDelivery(id int64, attempts int, lastError string) error
+	GetDeadDeliveries(webhookID string, limit int) (*sql.Rows, error)
+	RequeueDelivery(id int64) (bool, error)
+}
+
+// WebhookDispatcher signs events and delivers them to matching webhooks
+// through a retry queue kept in Postgres, so pending deliveries survive
+// restarts. Failed attempts back off exponentially from BaseDelay up to
+// MaxDelay; after MaxAttempts a delivery is dead-lettered.
+//
+// Webhook URLs may not point at loopback, private, link-local or other
+// internal addresses, checked both when a webhook is saved and on every
+// connection, unless the host is listed in AllowedHosts.
+type WebhookDispatcher struct {
+	MaxAttempts  int
+	BaseDelay    time.Duration
+	MaxDelay     time.Duration
+	AllowedHosts []string // host names or IPs exempt from the address check
+
+	// OnDelivery, if set, is called after every delivery attempt.
+	OnDelivery func(webhookID, result string, elapsed time.Duration)
+
+	db     webhookStore
+	client *http.Client
+	events chan Event
+	hooks  map[string]Webhook
+	mu     sync.RWMutex
+}
+
+// webhookBacklog is how many published events may wait to be queued.
+const webhookBacklog = 1000
+
+func NewWebhookDispatcher(pg *db.PostgresDB) *WebhookDispatcher {
+	return newWebhookDispatcher(pg)
+}
+
+func newWebhookDispatcher(store webhookStore) *WebhookDispatcher {
+	d := &WebhookDispatcher{
+		MaxAttempts: 8,
+		BaseDelay:   5 * time.Second,
+		MaxDelay:    time.Hour,
+		db:          store,
+		events:      make(chan Event, webhookBacklog),
+		hooks:       make(map[string]Webhook),
+	}
+	d.client = &http.Client{
+		Timeout:   10 * time.Second,
+		Transport: &http.Transport{DialContext: d.dial},
+	}
+	return d
+}
+
+func (d *WebhookDispatcher) allowed(host string) bool {
+	for _, h := range d.AllowedHosts {
+		if strings.EqualFold(h, host) {
+			return true
+		}
+	}
+	return false
+}
+
+// internalIP reports whether ip is an address webhooks must not reach.
+func internalIP(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast()
+}
+
+// checkHost rejects hosts that resolve to an internal address.
+func (d *WebhookDispatcher) checkHost(host string) error {
+	if d.allowed(host) {
+		return nil
+	}
+	ips, err := net.LookupIP(host)
+	if err != nil {
+		return fmt.Errorf("cannot resolve %s: %w", host, err)
+	}
+	for _, ip := range ips {
+		if internalIP(ip) {
+			return fmt.Errorf("%s resolves to internal address %s", host, ip)
+		}
+	}
+	return nil
+}
+
+// dial refuses internal addresses at connection time too, so a host can't
+// pass the check in Set and later resolve somewhere else, and redirects
+// can't reach internal services either.
+func (d *WebhookDispatcher) dial(ctx context.Context, network, addr string) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	if !d.allowed(host) {
+		dialer.Control = func(_, address string, _ syscall.RawConn) error {
+			ipStr, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(ipStr); ip == nil || internalIP(ip) {
+				return fmt.Errorf("webhook target %s is an internal address", ipStr)
+			}
+			return nil
+		}
+	}
+	return dialer.DialContext(ctx, network, addr)
+}
+
+func (d *WebhookDispatcher) Name() string { return "webhook" }
+
+// Load reads the stored webhook subscriptions.
+func (d *WebhookDispatcher) Load() error {
+	rows, err := d.db.GetWebhooks()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for rows.Next() {
+		var config []byte
+		var w Webhook
+		if err := rows.Scan(&config); err != nil || json.Unmarshal(config, &w) != nil {
+			continue
+		}
+		d.hooks[w.ID] = w
+	}
+	return rows.Err()
+}
+
+// Set validates and stores a webhook. New webhooks without a secret get a
+// generated one, which is only returned here.
+func (d *WebhookDispatcher) Set(w Webhook) (Webhook, error) {
+	u, err := url.Parse(w.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return w, fmt.Errorf("url must be an absolute http or https URL")
+	}
+	if err := d.checkHost(u.Hostname()); err != nil {
+		return w, err
+	}
+	for i, s := range w.Symbols {
+		w.Symbols[i] = strings.ToUpper(s)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if w.ID == "" {
+		w.ID = newID()
+		w.CreatedAt = time.Now()
+	} else if existing, ok := d.hooks[w.ID]; ok {
+		w.CreatedAt = existing.CreatedAt
+		if w.Secret == "" {
+			w.Secret = existing.Secret
+		}
+	} else {
+		return w, ErrWebhookNotFound
+	}
+	if w.Secret == "" {
+		w.Secret = newSecret()
+	}
+	config, _ := json.Marshal(w)
+	if err := d.db.SaveWebhook(w.ID, config); err != nil {
+		return w, err
+	}
+	d.hooks[w.ID] = w
+	return w, nil
+}
+
+func (d *WebhookDispatcher) Delete(id string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if _, ok := d.hooks[id]; !ok {
+		return ErrWebhookNotFound
+	}
+	if err := d.db.DeleteWebhook(id); err != nil {
+		return err
+	}
+	delete(d.hooks, id)
+	return nil
+}
+
+// Webhooks lists the subscriptions with their secrets redacted.
+func (d *WebhookDispatcher) Webhooks() []Webhook {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	out := make([]Webhook, 0, len(d.hooks))
+	for _, w := range d.hooks {
+		w.Secret = ""
+		out = append(out, w)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.Before(out[j].CreatedAt) })
+	return out
+}
+
+// Notify hands the event to Run, which queues it for every matching
+// webhook. Events are dropped if Run falls too far behind.
+func (d *WebhookDispatcher) Notify(e Event) {
+	select {
+	case d.events <- e:
+	default:
+		log.Printf("Warning: webhook backlog full, dropping %s event %s", e.Type, e.ID)
+	}
+}
+
+func (d *WebhookDispatcher) enqueue(e Event) {
+	d.mu.RLock()
+	var targets []string
+	for id, w := range d.hooks {
+		if w.matches(e) {
+			targets = append(targets, id)
+		}
+	}
+	d.mu.RUnlock()
+	if len(targets) == 0 {
+		return
+	}
+	payload, err := json.Marshal(e)
+	if err != nil {
+		log.Printf("Warning: failed to encode %s event for webhooks: %v", e.Type, err)
+		return
+	}
+	for _, id := range targets {
+		if err := d.db.EnqueueDelivery(id, e.ID, e.Type, payload); err != nil {
+			log.Printf("Warning: failed to queue webhook delivery to %s: %v", id, err)
+		}
+	}
+}
+
+// Run queues published events and works through due deliveries every
+// interval until ctx is cancelled.
+func (d *WebhookDispatcher) Run(ctx context.Context, interval time.Duration) {
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case e := <-d.events:
+				d.enqueue(e)
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			d.processDue(ctx)
+		}
+	}
+}
+
+type queuedDelivery struct {
+	id        int64
+	webhookID string
+	eventID   string
+	eventType string
+	payload   []byte
+	attempts  int
+}
+
+func (d *WebhookDispatcher) processDue(ctx context.Context) {
+	rows, err := d.db.GetDueDeliveries(100)
+	if err != nil {
+		log.Printf("Warning: failed to read webhook queue: %v", err)
+		return
+	}
+	var due []queuedDelivery
+	for rows.Next() {
+		var q queuedDelivery
+		var payload string
+		if err := rows.Scan(&q.id, &q.webhookID, &q.eventID, &q.eventType, &payload, &q.attempts); err != nil {
+			continue
+		}
+		q.payload = []byte(payload)
+		due = append(due, q)
+	}
+	rows.Close()
+
+	var wg sync.WaitGroup
+	for _, q := range due {
+		d.mu.RLock()
+		w, ok := d.hooks[q.webhookID]
+		d.mu.RUnlock()
+		if !ok {
+			d.db.CompleteDelivery(q.id)
+			continue
+		}
+		wg.Add(1)
+		go func(q queuedDelivery, w Webhook) {
+			defer wg.Done()
+			d.attempt(ctx, q, w)
+		}(q, w)
+	}
+	wg.Wait()
+}
+
+func (d *WebhookDispatcher) attempt(ctx context.Context, q queuedDelivery, w Webhook) {
+	start := time.Now()
+	_, err := d.send(ctx, w, q.eventID, q.eventType, q.payload)
+	elapsed := time.Since(start)
+	attempts := q.attempts + 1
+
+	result := ResultDelivered
+	switch {
+	case err == nil:
+		err = d.db.CompleteDelivery(q.id)
+	case attempts >= d.MaxAttempts:
+		result = ResultDead
+		log.Printf("Webhook delivery %d to %s dead-lettered after %d attempts: %v", q.id, w.ID, attempts, err)
+		err = d.db.DeadLetterDelivery(q.id, attempts, err.Error())
+	default:
+		result = ResultRetry
+		err = d.db.RetryDelivery(q.id, attempts, d.backoff(attempts), err.Error())
+	}
+	if err != nil {
+		log.Printf("Warning: failed to update webhook delivery %d: %v", q.id, err)
+	}
+	if d.OnDelivery != nil {
+		d.OnDelivery(w.ID, result, elapsed)
+	}
+}
+
+// backoff doubles the delay for each failed attempt, with jitter so that
+// deliveries failing together don't retry in lockstep.
+func (d *WebhookDispatcher) backoff(attempts int) time.Duration {
+	delay := d.BaseDelay
+	for i := 1; i < attempts && delay < d.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > d.MaxDelay {
+		delay = d.MaxDelay
+	}
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// send POSTs a signed payload and returns the response status. Any non-2xx
+// status is an error.
+func (d *WebhookDispatcher) send(ctx context.Context, w Webhook, eventID, eventType string, payload []byte) (int, error) {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-StockTrader-Event", eventType)
+	req.Header.Set("X-StockTrader-Delivery", eventID)
+	req.Header.Set("X-StockTrader-Timestamp", timestamp)
+	req.Header.Set("X-StockTrader-Signature", "sha256="+Sign(w.Secret, timestamp, payload))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("endpoint responded %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// Test sends a signed test event straight to a webhook, bypassing the queue.
+func (d *WebhookDispatcher) Test(ctx context.Context, id string) (TestResult, error) {
+	d.mu.RLock()
+	w, ok := d.hooks[id]
+	d.mu.RUnlock()
+	if !ok {
+		return TestResult{}, ErrWebhookNotFound
+	}
+	e := NewEvent("test", "", map[string]string{"message": "Test delivery from StockTrader."})
+	payload, _ := json.Marshal(e)
+
+	start := time.Now()
+	status, err := d.send(ctx, w, e.ID, e.Type, payload)
+	result := TestResult{StatusCode: status, LatencyMs: float64(time.Since(start).Microseconds()) / 1000}
+	if err != nil {
+		result.Error = err.Error()
+	}
+	return result, nil
+}
+
+// DeadDeliveries lists dead-lettered deliveries, optionally for one webhook.
+func (d *WebhookDispatcher) DeadDeliveries(webhookID string, limit int) ([]DeadDelivery, error) {
+	rows, err := d.db.GetDeadDeliveries(webhookID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []DeadDelivery{}
+	for rows.Next() {
+		var dd DeadDelivery
+		if err := rows.Scan(&dd.ID, &dd.WebhookID, &dd.EventID, &dd.EventType, &dd.Attempts, &dd.LastError, &dd.CreatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, dd)
+	}
+	return out, rows.Err()
+}
+
+// Requeue puts a dead-lettered delivery back on the queue.
+func (d *WebhookDispatcher) Requeue(id int64) (bool, error) {
+	return d.db.RequeueDelivery(id)
+}
+
+// Sign computes the hex HMAC-SHA256 of "<timestamp>.<payload>". Receivers
+// should recompute it from the X-StockTrader-Timestamp header and the raw
+// body, and reject stale timestamps to prevent replays.
+func Sign(secret, timestamp string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func contains(xs []string, s string) bool {
+	for _, x := range xs {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,241 @@
+package notify
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memoryStore records the queue updates the dispatcher makes.
+type memoryStore struct {
+	mu        sync.Mutex
+	saved     map[string][]byte
+	enqueued  []string // webhook IDs
+	completed []int64
+	retried   []int
+	dead      []int
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{saved: make(map[string][]byte)}
+}
+
+var errNoRows = errors.New("not supported by memoryStore")
+
+func (m *memoryStore) GetWebhooks() (*sql.Rows, error) { return nil, errNoRows }
+
+func (m *memoryStore) SaveWebhook(id string, config []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.saved[id] = config
+	return nil
+}
+
+func (m *memoryStore) DeleteWebhook(id string) error { return nil }
+
+func (m *memoryStore) EnqueueDelivery(webhookID, eventID, eventType string, payload []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.enqueued = append(m.enqueued, webhookID)
+	return nil
+}
+
+func (m *memoryStore) GetDueDeliveries(limit int) (*sql.Rows, error) { return nil, errNoRows }
+
+func (m *memoryStore) CompleteDelivery(id int64) error {
+	m.completed = append(m.completed, id)
+	return nil
+}
+
+func (m *memoryStore) RetryDelivery(id int64, attempts int, delay time.Duration, lastError string) error {
+	m.retried = append(m.retried, attempts)
+	return nil
+}
+
+func (m *memoryStore) DeadLetterDelivery(id int64, attempts int, lastError string) error {
+	m.dead = append(m.dead, attempts)
+	return nil
+}
+
+func (m *memoryStore) GetDeadDeliveries(webhookID string, limit int) (*sql.Rows, error) {
+	return nil, errNoRows
+}
+
+func (m *memoryStore) RequeueDelivery(id int64) (bool, error) { return false, nil }
+
+func TestSign(t *testing.T) {
+	got := Sign("secret", "1700000000", []byte(`{"id":"1"}`))
+	want := "086f6aff7bd084c98679825129c5a64dbad88c760016d6d2c0fb123f27951d54"
+	if got != want {
+		t.Errorf("Sign = %s, want %s", got, want)
+	}
+}
+
+func TestSendSignsPayload(t *testing.T) {
+	var got *http.Request
+	var body []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		body, _ = io.ReadAll(r.Body)
+	}))
+	defer srv.Close()
+
+	d := newWebhookDispatcher(newMemoryStore())
+	d.AllowedHosts = []string{"127.0.0.1"}
+	w := Webhook{ID: "hook", URL: srv.URL, Secret: "secret"}
+	payload := []byte(`{"id":"evt"}`)
+	status, err := d.send(context.Background(), w, "evt", "anomaly", payload)
+	if err != nil || status != http.StatusOK {
+		t.Fatalf("send = %d, %v", status, err)
+	}
+	if string(body) != string(payload) {
+		t.Errorf("body = %s, want %s", body, payload)
+	}
+	if h := got.Header.Get("X-StockTrader-Event"); h != "anomaly" {
+		t.Errorf("event header = %q", h)
+	}
+	if h := got.Header.Get("X-StockTrader-Delivery"); h != "evt" {
+		t.Errorf("delivery header = %q", h)
+	}
+	want := "sha256=" + Sign("secret", got.Header.Get("X-StockTrader-Timestamp"), body)
+	if h := got.Header.Get("X-StockTrader-Signature"); h != want {
+		t.Errorf("signature = %q, want %q", h, want)
+	}
+}
+
+func TestInternalTargetsRejected(t *testing.T) {
+	d := newWebhookDispatcher(newMemoryStore())
+	for _, u := range []string{
+		"http://127.0.0.1:8080/hook",
+		"http://localhost/hook",
+		"http://[::1]/hook",
+		"http://10.1.2.3/hook",
+		"http://192.168.0.10/hook",
+		"http://169.254.169.254/latest/meta-data",
+		"http://0.0.0.0/hook",
+	} {
+		if _, err := d.Set(Webhook{URL: u}); err == nil {
+			t.Errorf("Set(%s) succeeded, want it rejected", u)
+		}
+	}
+
+	// Connections are checked as well, so redirects and DNS changes can't
+	// reach internal addresses
+	srv := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	defer srv.Close()
+	if _, err := d.send(context.Background(), Webhook{URL: srv.URL}, "evt", "test", nil); err == nil {
+		t.Error("send to a loopback server succeeded, want it refused")
+	}
+
+	d.AllowedHosts = []string{"127.0.0.1"}
+	if _, err := d.Set(Webhook{URL: srv.URL}); err != nil {
+		t.Errorf("Set with an allow-listed host: %v", err)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	d := newWebhookDispatcher(newMemoryStore())
+	d.BaseDelay, d.MaxDelay = time.Second, 10*time.Second
+	for attempts, full := range map[int]time.Duration{
+		1: time.Second,
+		2: 2 * time.Second,
+		3: 4 * time.Second,
+		4: 8 * time.Second,
+		5: 10 * time.Second,
+		9: 10 * time.Second,
+	} {
+		for i := 0; i < 50; i++ {
+			delay := d.backoff(attempts)
+			if delay < full/2 || delay > full {
+				t.Fatalf("backoff(%d) = %v, want between %v and %v", attempts, delay, full/2, full)
+			}
+		}
+	}
+}
+
+func TestAttemptRetriesThenDeadLetters(t *testing.T) {
+	status := http.StatusInternalServerError
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	store := newMemoryStore()
+	d := newWebhookDispatcher(store)
+	d.AllowedHosts = []string{"127.0.0.1"}
+	d.MaxAttempts = 3
+	var results []string
+	d.OnDelivery = func(_, result string, _ time.Duration) { results = append(results, result) }
+
+	w := Webhook{ID: "hook", URL: srv.URL, Secret: "secret"}
+	q := queuedDelivery{id: 7, webhookID: "hook", eventID: "evt", eventType: "anomaly", payload: []byte(`{}`)}
+	for q.attempts = 0; q.attempts < d.MaxAttempts; q.attempts++ {
+		d.attempt(context.Background(), q, w)
+	}
+	if len(store.retried) != 2 || store.retried[0] != 1 || store.retried[1] != 2 {
+		t.Errorf("retried = %v, want [1 2]", store.retried)
+	}
+	if len(store.dead) != 1 || store.dead[0] != 3 {
+		t.Errorf("dead = %v, want [3]", store.dead)
+	}
+
+	status = http.StatusNoContent
+	d.attempt(context.Background(), q, w)
+	if len(store.completed) != 1 || store.completed[0] != 7 {
+		t.Errorf("completed = %v, want [7]", store.completed)
+	}
+
+	want := []string{ResultRetry, ResultRetry, ResultDead, ResultDelivered}
+	if len(results) != len(want) {
+		t.Fatalf("results = %v, want %v", results, want)
+	}
+	for i := range want {
+		if results[i] != want[i] {
+			t.Errorf("results = %v, want %v", results, want)
+			break
+		}
+	}
+}
+
+func TestNotifyQueuesInBackground(t *testing.T) {
+	store := newMemoryStore()
+	d := newWebhookDispatcher(store)
+	d.AllowedHosts = []string{"example.test"}
+	d.hooks["a"] = Webhook{ID: "a", URL: "http://example.test/a", Symbols: []string{"AAPL"}}
+	d.hooks["b"] = Webhook{ID: "b", URL: "http://example.test/b", EventTypes: []string{"alert"}}
+
+	// Notify never blocks, even with nothing draining the backlog
+	for i := 0; i < webhookBacklog+10; i++ {
+		d.Notify(NewEvent("anomaly", "MSFT", nil))
+	}
+	for len(d.events) > 0 {
+		<-d.events
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go d.Run(ctx, time.Hour)
+	d.Notify(NewEvent("anomaly", "AAPL", nil))
+	d.Notify(NewEvent("alert", "MSFT", nil))
+	d.Notify(NewEvent("anomaly", "MSFT", nil))
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		store.mu.Lock()
+		n := len(store.enqueued)
+		store.mu.Unlock()
+		if n == 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("enqueued %d deliveries, want 2", n)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
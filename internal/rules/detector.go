@@ -0,0 +1,103 @@
+package rules
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Fahadada-code/StockTrader/internal/analytics"
+)
+
+// SeriesFunc returns the recent price history for a symbol, oldest first.
+type SeriesFunc func(symbol string) ([]float64, []time.Time)
+
+// Detector evaluates a rule set against every observation so user-defined
+// rules flow through the same registry, episode and broadcast path as the
+// built-in detectors.
+type Detector struct {
+	set    *Set
+	series SeriesFunc
+}
+
+func NewDetector(set *Set, series SeriesFunc) *Detector {
+	return &Detector{set: set, series: series}
+}
+
+func (d *Detector) Name() string { return "rules" }
+
+func (d *Detector) Detect(obs analytics.Observation) []analytics.Anomaly {
+	ctx := &Context{Vars: Vars(obs)}
+	if d.series != nil {
+		ctx.Prices, ctx.Times = d.series(obs.Symbol)
+	}
+
+	// Rules either hold or don't, so there is no magnitude to report. It is
+	// left at 0, which keeps rule episodes out of magnitude-based escalation.
+	var anomalies []analytics.Anomaly
+	for _, r := range d.set.Matching(obs.Symbol, ctx) {
+		details := r.Message
+		if details == "" {
+			details = fmt.Sprintf("Rule %s matched: %s", r.Name, r.Expr)
+		}
+		anomalies = append(anomalies, analytics.Anomaly{
+			Symbol:     obs.Symbol,
+			Type:       "rule:" + r.Name,
+			Severity:   r.Severity,
+			Confidence: severityConfidence(r.Severity),
+			Details:    details,
+		})
+	}
+	return anomalies
+}
+
+// Vars exposes an observation under the names rule expressions use. Values
+// that are not known for this tick are left out.
+func Vars(obs analytics.Observation) map[string]float64 {
+	t, m := obs.Tick, obs.Metrics
+	vars := map[string]float64{
+		"price":            t.Price,
+		"volume":           t.Volume,
+		"vwap":             m.VWAP,
+		"volatility":       m.Volatility,
+		"vol_log_return":   m.VolatilityEstimates.LogReturn,
+		"vol_ewma":         m.VolatilityEstimates.EWMA,
+		"vol_parkinson":    m.VolatilityEstimates.Parkinson,
+		"vol_garman_klass": m.VolatilityEstimates.GarmanKlass,
+		"price_change":     m.PriceChange,
+		"volume_change":    m.VolumeChange,
+		"volume_ratio":     1 + m.VolumeChange/100,
+	}
+	if t.Open > 0 {
+		vars["open"] = t.Open
+	}
+	if t.High > 0 {
+		vars["high"] = t.High
+	}
+	if t.Low > 0 {
+		vars["low"] = t.Low
+	}
+	if pc := obs.PreviousClose; pc > 0 {
+		vars["prev_close"] = pc
+		vars["day_change_pct"] = (t.Price - pc) / pc * 100
+		if t.Open > 0 {
+			vars["gap_pct"] = (t.Open - pc) / pc * 100
+		}
+	}
+	if rel := m.Relative; rel != nil {
+		vars["beta"] = rel.Beta
+		vars["alpha"] = rel.Alpha
+		vars["relative_strength"] = rel.RelativeStrength
+	}
+	return vars
+}
+
+// severityConfidence maps a rule's fixed severity back onto the confidence
+// scale stored with every anomaly.
+func severityConfidence(s analytics.Severity) float64 {
+	switch s {
+	case analytics.SeverityCritical:
+		return 0.99
+	case analytics.SeverityWarning:
+		return 0.9
+	}
+	return 0.5
+}
@@ -0,0 +1,563 @@
+package rules
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Context is what an expression is evaluated against: named scalar values
+// plus the recent price history used by the indicator functions.
+type Context struct {
+	Vars   map[string]float64
+	Prices []float64   // oldest first
+	Times  []time.Time // parallel to Prices
+}
+
+type kind int
+
+const (
+	kindNumber kind = iota
+	kindBool
+	kindDuration
+)
+
+func (k kind) String() string {
+	switch k {
+	case kindBool:
+		return "boolean"
+	case kindDuration:
+		return "duration"
+	}
+	return "number"
+}
+
+type value struct {
+	num float64
+	b   bool
+	dur time.Duration
+}
+
+// node is a compiled expression. eval reports false when a referenced value
+// is unavailable for this tick, in which case the rule does not fire.
+type node struct {
+	kind kind
+	eval func(ctx *Context) (value, bool)
+}
+
+// Variables lists the names an expression may reference.
+var Variables = map[string]string{
+	"price":             "last trade price",
+	"volume":            "volume traded since the previous quote",
+	"open":              "session open",
+	"high":              "session high",
+	"low":               "session low",
+	"prev_close":        "previous session close",
+	"day_change_pct":    "percent change from the previous close",
+	"gap_pct":           "percent gap between the open and the previous close",
+	"vwap":              "rolling volume-weighted average price",
+	"volatility":        "volatility from the configured estimator",
+	"vol_log_return":    "annualized log-return volatility",
+	"vol_ewma":          "annualized EWMA volatility",
+	"vol_parkinson":     "annualized Parkinson volatility",
+	"vol_garman_klass":  "annualized Garman-Klass volatility",
+	"price_change":      "percent change across the rolling window",
+	"volume_change":     "percent change of interval volume versus the window average",
+	"volume_ratio":      "interval volume divided by the window average",
+	"beta":              "beta versus the benchmark",
+	"alpha":             "alpha versus the benchmark",
+	"relative_strength": "growth relative to the benchmark",
+}
+
+type function struct {
+	args []kind
+	ret  kind
+	call func(ctx *Context, args []value) (value, bool)
+}
+
+var functions = map[string]function{
+	"pct_change": {args: []kind{kindDuration}, ret: kindNumber, call: pctChange},
+	"sma":        {args: []kind{kindNumber}, ret: kindNumber, call: sma},
+	"ema":        {args: []kind{kindNumber}, ret: kindNumber, call: ema},
+	"abs": {args: []kind{kindNumber}, ret: kindNumber, call: func(_ *Context, a []value) (value, bool) {
+		return value{num: math.Abs(a[0].num)}, true
+	}},
+	"min": {args: []kind{kindNumber, kindNumber}, ret: kindNumber, call: func(_ *Context, a []value) (value, bool) {
+		return value{num: math.Min(a[0].num, a[1].num)}, true
+	}},
+	"max": {args: []kind{kindNumber, kindNumber}, ret: kindNumber, call: func(_ *Context, a []value) (value, bool) {
+		return value{num: math.Max(a[0].num, a[1].num)}, true
+	}},
+}
+
+// pctChange is the percent change from the last price at least d old.
+func pctChange(ctx *Context, a []value) (value, bool) {
+	n := len(ctx.Prices)
+	if n < 2 || len(ctx.Times) != n {
+		return value{}, false
+	}
+	cutoff := ctx.Times[n-1].Add(-a[0].dur)
+	for i := n - 2; i >= 0; i-- {
+		if !ctx.Times[i].After(cutoff) {
+			if ctx.Prices[i] == 0 {
+				return value{}, false
+			}
+			return value{num: (ctx.Prices[n-1] - ctx.Prices[i]) / ctx.Prices[i] * 100}, true
+		}
+	}
+	return value{}, false
+}
+
+func sma(ctx *Context, a []value) (value, bool) {
+	n := int(a[0].num)
+	if n < 1 || n > len(ctx.Prices) {
+		return value{}, false
+	}
+	var sum float64
+	for _, p := range ctx.Prices[len(ctx.Prices)-n:] {
+		sum += p
+	}
+	return value{num: sum / float64(n)}, true
+}
+
+func ema(ctx *Context, a []value) (value, bool) {
+	n := int(a[0].num)
+	if n < 1 || n > len(ctx.Prices) {
+		return value{}, false
+	}
+	k := 2 / float64(n+1)
+	e := ctx.Prices[0]
+	for _, p := range ctx.Prices[1:] {
+		e = k*p + (1-k)*e
+	}
+	return value{num: e}, true
+}
+
+// Expr is a compiled, type-checked rule condition.
+type Expr struct {
+	root *node
+}
+
+// Eval reports whether the condition holds. It is false whenever a value the
+// expression needs is unavailable.
+func (e *Expr) Eval(ctx *Context) bool {
+	v, ok := e.root.eval(ctx)
+	return ok && v.b
+}
+
+// Compile parses and type-checks a boolean rule expression.
+func Compile(src string) (*Expr, error) {
+	tokens, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	n, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, fmt.Errorf("unexpected %q at offset %d", t.text, t.pos)
+	}
+	if n.kind != kindBool {
+		return nil, fmt.Errorf("expression must be a condition, got a %s", n.kind)
+	}
+	return &Expr{root: n}, nil
+}
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokNumber
+	tokDuration
+	tokIdent
+	tokOp
+	tokLParen
+	tokRParen
+	tokComma
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+	num  float64
+	dur  time.Duration
+}
+
+func lex(src string) ([]token, error) {
+	var tokens []token
+	i := 0
+	for i < len(src) {
+		c := rune(src[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case unicode.IsDigit(c) || c == '.':
+			start := i
+			for i < len(src) && (unicode.IsDigit(rune(src[i])) || src[i] == '.') {
+				i++
+			}
+			num, err := strconv.ParseFloat(src[start:i], 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid number %q at offset %d", src[start:i], start)
+			}
+			// A unit suffix makes it a duration, e.g. 5m or 1h
+			unitStart := i
+			for i < len(src) && unicode.IsLetter(rune(src[i])) {
+				i++
+			}
+			if unit := src[unitStart:i]; unit != "" {
+				d, err := time.ParseDuration(src[start:i])
+				if err != nil {
+					return nil, fmt.Errorf("invalid duration %q at offset %d", src[start:i], start)
+				}
+				tokens = append(tokens, token{kind: tokDuration, text: src[start:i], pos: start, dur: d})
+				continue
+			}
+			tokens = append(tokens, token{kind: tokNumber, text: src[start:i], pos: start, num: num})
+		case unicode.IsLetter(c) || c == '_':
+			start := i
+			for i < len(src) && (unicode.IsLetter(rune(src[i])) || unicode.IsDigit(rune(src[i])) || src[i] == '_') {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokIdent, text: strings.ToLower(src[start:i]), pos: start})
+		case c == '(':
+			tokens = append(tokens, token{kind: tokLParen, text: "(", pos: i})
+			i++
+		case c == ')':
+			tokens = append(tokens, token{kind: tokRParen, text: ")", pos: i})
+			i++
+		case c == ',':
+			tokens = append(tokens, token{kind: tokComma, text: ",", pos: i})
+			i++
+		default:
+			op := ""
+			for _, candidate := range []string{"<=", ">=", "==", "!=", "&&", "||", "<", ">", "+", "-", "*", "/", "!"} {
+				if strings.HasPrefix(src[i:], candidate) {
+					op = candidate
+					break
+				}
+			}
+			if op == "" {
+				return nil, fmt.Errorf("unexpected character %q at offset %d", c, i)
+			}
+			text := op
+			switch op {
+			case "&&":
+				text = "and"
+			case "||":
+				text = "or"
+			case "!":
+				text = "not"
+			}
+			tokens = append(tokens, token{kind: tokOp, text: text, pos: i})
+			i += len(op)
+		}
+	}
+	return append(tokens, token{kind: tokEOF, pos: len(src)}), nil
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() token { return p.tokens[p.pos] }
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+// isKeyword matches both the word and symbolic spellings of and/or/not.
+func (p *parser) isKeyword(word string) bool {
+	t := p.peek()
+	return (t.kind == tokIdent || t.kind == tokOp) && t.text == word
+}
+
+func (p *parser) parseOr() (*node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.isKeyword("or") {
+		t := p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		if err := expect(t, kindBool, left, right); err != nil {
+			return nil, err
+		}
+		l, r := left, right
+		left = &node{kind: kindBool, eval: func(ctx *Context) (value, bool) {
+			if a, ok := l.eval(ctx); ok && a.b {
+				return a, true
+			}
+			return r.eval(ctx)
+		}}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (*node, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.isKeyword("and") {
+		t := p.next()
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		if err := expect(t, kindBool, left, right); err != nil {
+			return nil, err
+		}
+		l, r := left, right
+		left = &node{kind: kindBool, eval: func(ctx *Context) (value, bool) {
+			a, ok := l.eval(ctx)
+			if !ok || !a.b {
+				return value{}, ok
+			}
+			return r.eval(ctx)
+		}}
+	}
+	return left, nil
+}
+
+func (p *parser) parseNot() (*node, error) {
+	if p.isKeyword("not") {
+		t := p.next()
+		operand, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		if err := expect(t, kindBool, operand); err != nil {
+			return nil, err
+		}
+		return &node{kind: kindBool, eval: func(ctx *Context) (value, bool) {
+			v, ok := operand.eval(ctx)
+			return value{b: !v.b}, ok
+		}}, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *parser) parseComparison() (*node, error) {
+	left, err := p.parseSum()
+	if err != nil {
+		return nil, err
+	}
+	t := p.peek()
+	if t.kind != tokOp {
+		return left, nil
+	}
+	var cmp func(a, b float64) bool
+	switch t.text {
+	case "<":
+		cmp = func(a, b float64) bool { return a < b }
+	case "<=":
+		cmp = func(a, b float64) bool { return a <= b }
+	case ">":
+		cmp = func(a, b float64) bool { return a > b }
+	case ">=":
+		cmp = func(a, b float64) bool { return a >= b }
+	case "==":
+		cmp = func(a, b float64) bool { return a == b }
+	case "!=":
+		cmp = func(a, b float64) bool { return a != b }
+	default:
+		return left, nil
+	}
+	p.next()
+	right, err := p.parseSum()
+	if err != nil {
+		return nil, err
+	}
+	if err := expect(t, kindNumber, left, right); err != nil {
+		return nil, err
+	}
+	return &node{kind: kindBool, eval: func(ctx *Context) (value, bool) {
+		a, ok := left.eval(ctx)
+		if !ok {
+			return value{}, false
+		}
+		b, ok := right.eval(ctx)
+		if !ok {
+			return value{}, false
+		}
+		return value{b: cmp(a.num, b.num)}, true
+	}}, nil
+}
+
+func (p *parser) parseSum() (*node, error) {
+	return p.parseArithmetic(p.parseProduct, "+", "-")
+}
+
+func (p *parser) parseProduct() (*node, error) {
+	return p.parseArithmetic(p.parseUnary, "*", "/")
+}
+
+func (p *parser) parseArithmetic(operand func() (*node, error), ops ...string) (*node, error) {
+	left, err := operand()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		if t.kind != tokOp || (t.text != ops[0] && t.text != ops[1]) {
+			return left, nil
+		}
+		p.next()
+		right, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		if err := expect(t, kindNumber, left, right); err != nil {
+			return nil, err
+		}
+		l, r, op := left, right, t.text
+		left = &node{kind: kindNumber, eval: func(ctx *Context) (value, bool) {
+			a, ok := l.eval(ctx)
+			if !ok {
+				return value{}, false
+			}
+			b, ok := r.eval(ctx)
+			if !ok {
+				return value{}, false
+			}
+			switch op {
+			case "+":
+				return value{num: a.num + b.num}, true
+			case "-":
+				return value{num: a.num - b.num}, true
+			case "*":
+				return value{num: a.num * b.num}, true
+			}
+			if b.num == 0 {
+				return value{}, false
+			}
+			return value{num: a.num / b.num}, true
+		}}
+	}
+}
+
+func (p *parser) parseUnary() (*node, error) {
+	if t := p.peek(); t.kind == tokOp && t.text == "-" {
+		p.next()
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		if err := expect(t, kindNumber, operand); err != nil {
+			return nil, err
+		}
+		return &node{kind: kindNumber, eval: func(ctx *Context) (value, bool) {
+			v, ok := operand.eval(ctx)
+			return value{num: -v.num}, ok
+		}}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (*node, error) {
+	t := p.next()
+	switch t.kind {
+	case tokNumber:
+		v := value{num: t.num}
+		return &node{kind: kindNumber, eval: func(*Context) (value, bool) { return v, true }}, nil
+	case tokDuration:
+		v := value{dur: t.dur}
+		return &node{kind: kindDuration, eval: func(*Context) (value, bool) { return v, true }}, nil
+	case tokLParen:
+		n, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if r := p.next(); r.kind != tokRParen {
+			return nil, fmt.Errorf("expected ')' at offset %d", r.pos)
+		}
+		return n, nil
+	case tokIdent:
+		if p.peek().kind == tokLParen {
+			return p.parseCall(t)
+		}
+		if t.text == "true" || t.text == "false" {
+			v := value{b: t.text == "true"}
+			return &node{kind: kindBool, eval: func(*Context) (value, bool) { return v, true }}, nil
+		}
+		if _, ok := Variables[t.text]; !ok {
+			return nil, fmt.Errorf("unknown variable %q at offset %d", t.text, t.pos)
+		}
+		name := t.text
+		return &node{kind: kindNumber, eval: func(ctx *Context) (value, bool) {
+			v, ok := ctx.Vars[name]
+			return value{num: v}, ok
+		}}, nil
+	case tokEOF:
+		return nil, fmt.Errorf("unexpected end of expression")
+	}
+	return nil, fmt.Errorf("unexpected %q at offset %d", t.text, t.pos)
+}
+
+func (p *parser) parseCall(name token) (*node, error) {
+	fn, ok := functions[name.text]
+	if !ok {
+		return nil, fmt.Errorf("unknown function %q at offset %d", name.text, name.pos)
+	}
+	p.next() // (
+	var args []*node
+	if p.peek().kind != tokRParen {
+		for {
+			arg, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, arg)
+			if p.peek().kind != tokComma {
+				break
+			}
+			p.next()
+		}
+	}
+	if r := p.next(); r.kind != tokRParen {
+		return nil, fmt.Errorf("expected ')' at offset %d", r.pos)
+	}
+	if len(args) != len(fn.args) {
+		return nil, fmt.Errorf("%s takes %d argument(s), got %d", name.text, len(fn.args), len(args))
+	}
+	for i, arg := range args {
+		if arg.kind != fn.args[i] {
+			return nil, fmt.Errorf("argument %d of %s must be a %s, got a %s", i+1, name.text, fn.args[i], arg.kind)
+		}
+	}
+	return &node{kind: fn.ret, eval: func(ctx *Context) (value, bool) {
+		vals := make([]value, len(args))
+		for i, arg := range args {
+			v, ok := arg.eval(ctx)
+			if !ok {
+				return value{}, false
+			}
+			vals[i] = v
+		}
+		return fn.call(ctx, vals)
+	}}, nil
+}
+
+func expect(op token, want kind, operands ...*node) error {
+	for _, n := range operands {
+		if n.kind != want {
+			return fmt.Errorf("operator %q at offset %d needs %s operands, got a %s", op.text, op.pos, want, n.kind)
+		}
+	}
+	return nil
+}
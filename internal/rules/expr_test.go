@@ -0,0 +1,107 @@
+package rules
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCompileErrors(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string // substring of the error
+	}{
+		{"", "unexpected end of expression"},
+		{"price >", "unexpected end of expression"},
+		{"price > 10)", `unexpected ")"`},
+		{"(price > 10", "expected ')'"},
+		{"price > 10 $", "unexpected character"},
+		{"1..2 > 1", "invalid number"},
+		{"pct_change(5q) > 1", "invalid duration"},
+		{"bogus > 1", `unknown variable "bogus"`},
+		{"bogus(1) > 1", `unknown function "bogus"`},
+		{"price", "must be a condition, got a number"},
+		{"5m", "must be a condition, got a duration"},
+		{"price and volume", "needs boolean operands, got a number"},
+		{"not price", "needs boolean operands"},
+		{"(price > 1) + 2 > 0", "needs number operands, got a boolean"},
+		{"-(price > 1)", "needs number operands"},
+		{"5m > 1", "needs number operands, got a duration"},
+		{"pct_change(5) > 1", "argument 1 of pct_change must be a duration, got a number"},
+		{"sma(5m) > 1", "argument 1 of sma must be a number, got a duration"},
+		{"max(price) > 1", "max takes 2 argument(s), got 1"},
+		{"abs() > 1", "abs takes 1 argument(s), got 0"},
+	}
+	for _, tt := range tests {
+		_, err := Compile(tt.src)
+		if err == nil {
+			t.Errorf("Compile(%q) succeeded, want error containing %q", tt.src, tt.want)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Compile(%q) error = %q, want it to contain %q", tt.src, err, tt.want)
+		}
+	}
+}
+
+func TestEval(t *testing.T) {
+	start := time.Date(2024, 1, 2, 15, 0, 0, 0, time.UTC)
+	ctx := &Context{
+		Vars: map[string]float64{
+			"price":          110,
+			"volume":         5000,
+			"prev_close":     100,
+			"day_change_pct": 10,
+			"volume_ratio":   3,
+		},
+		Prices: []float64{100, 102, 104, 106, 108, 110},
+	}
+	for i := range ctx.Prices {
+		ctx.Times = append(ctx.Times, start.Add(time.Duration(i)*time.Minute))
+	}
+
+	tests := []struct {
+		src  string
+		want bool
+	}{
+		{"price > 100", true},
+		{"price >= 110 and price <= 110", true},
+		{"price == 110 && volume != 0", true},
+		{"price < 100 or volume > 1000", true},
+		{"price < 100 || volume < 1000", false},
+		{"not price > 100", false},
+		{"!(price > 100)", false},
+		{"not not true", true},
+		{"false or true and false", false}, // and binds tighter than or
+		{"1 + 2 * 3 == 7", true},
+		{"(1 + 2) * 3 == 9", true},
+		{"-price < -100", true},
+		{"10 - 4 - 3 == 3", true}, // left associative
+		{"price / prev_close > 1.05", true},
+		{"PRICE > 100 AND Volume > 0", true}, // case insensitive
+		{"abs(-3) == 3 and min(1, 2) == 1 and max(1, 2) == 2", true},
+		{"sma(2) == 109", true},
+		{"sma(6) == 105", true},
+		{"ema(1) == 110", true},
+		{"pct_change(5m) == 10", true},
+		{"pct_change(2m) > 3.7 and pct_change(2m) < 3.8", true},
+
+		// Unavailable values make the whole condition false
+		{"vwap > 0", false},
+		{"not vwap > 0", false},
+		{"vwap > 0 or price > 100", true},
+		{"sma(7) > 0", false},
+		{"pct_change(1h) > -100", false},
+		{"price / 0 > 1", false},
+	}
+	for _, tt := range tests {
+		expr, err := Compile(tt.src)
+		if err != nil {
+			t.Errorf("Compile(%q): %v", tt.src, err)
+			continue
+		}
+		if got := expr.Eval(ctx); got != tt.want {
+			t.Errorf("Eval(%q) = %v, want %v", tt.src, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,224 @@
+package rules
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Fahadada-code/StockTrader/internal/analytics"
+)
+
+// Rule sources. File rules are replaced wholesale on every reload of the
+// rules file; API rules are managed individually and persisted by the caller.
+const (
+	SourceFile = "file"
+	SourceAPI  = "api"
+)
+
+var ErrNotFound = errors.New("rule not found")
+
+// Rule raises an anomaly of type "rule:<name>" whenever Expr holds for a
+// symbol. An empty Symbols list applies the rule to every symbol.
+type Rule struct {
+	Name     string             `json:"name"`
+	Expr     string             `json:"expr"`
+	Symbols  []string           `json:"symbols,omitempty"`
+	Severity analytics.Severity `json:"severity,omitempty"`
+	Message  string             `json:"message,omitempty"`
+	Source   string             `json:"source,omitempty"`
+}
+
+type compiledRule struct {
+	Rule
+	expr    *Expr
+	symbols map[string]bool
+}
+
+type Set struct {
+	rules   map[string]*compiledRule
+	modTime time.Time
+	mu      sync.RWMutex
+}
+
+func NewSet() *Set {
+	return &Set{rules: make(map[string]*compiledRule)}
+}
+
+func compile(r Rule) (*compiledRule, error) {
+	r.Name = strings.TrimSpace(r.Name)
+	if r.Name == "" {
+		return nil, fmt.Errorf("a rule needs a name")
+	}
+	if len(r.Name) > 40 {
+		return nil, fmt.Errorf("rule %s: name must be at most 40 characters", r.Name)
+	}
+	switch r.Severity {
+	case "":
+		r.Severity = analytics.SeverityWarning
+	case analytics.SeverityInfo, analytics.SeverityWarning, analytics.SeverityCritical:
+	default:
+		return nil, fmt.Errorf("rule %s: unknown severity %q", r.Name, r.Severity)
+	}
+	expr, err := Compile(r.Expr)
+	if err != nil {
+		return nil, fmt.Errorf("rule %s: %w", r.Name, err)
+	}
+	c := &compiledRule{Rule: r, expr: expr}
+	if len(r.Symbols) > 0 {
+		c.symbols = make(map[string]bool, len(r.Symbols))
+		for i, s := range r.Symbols {
+			r.Symbols[i] = strings.ToUpper(s)
+			c.symbols[r.Symbols[i]] = true
+		}
+	}
+	return c, nil
+}
+
+// Set validates and stores an API rule. It cannot replace a file rule.
+func (s *Set) Set(r Rule) (Rule, error) {
+	r.Source = SourceAPI
+	c, err := compile(r)
+	if err != nil {
+		return r, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if existing, ok := s.rules[c.Name]; ok && existing.Source == SourceFile {
+		return c.Rule, fmt.Errorf("rule %s is managed by the rules file", c.Name)
+	}
+	s.rules[c.Name] = c
+	return c.Rule, nil
+}
+
+func (s *Set) Get(name string) (Rule, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	c, ok := s.rules[name]
+	if !ok {
+		return Rule{}, false
+	}
+	return c.Rule, true
+}
+
+func (s *Set) Delete(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.rules[name]
+	if !ok {
+		return ErrNotFound
+	}
+	if c.Source == SourceFile {
+		return fmt.Errorf("rule %s is managed by the rules file", name)
+	}
+	delete(s.rules, name)
+	return nil
+}
+
+func (s *Set) Rules() []Rule {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]Rule, 0, len(s.rules))
+	for _, c := range s.rules {
+		out = append(out, c.Rule)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// LoadFile replaces the file rules with the JSON array at path. Every rule is
+// validated first, so a bad file leaves the current rules in place.
+func (s *Set) LoadFile(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var rules []Rule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return err
+	}
+	compiled := make(map[string]*compiledRule, len(rules))
+	for _, r := range rules {
+		r.Source = SourceFile
+		c, err := compile(r)
+		if err != nil {
+			return err
+		}
+		if _, dup := compiled[c.Name]; dup {
+			return fmt.Errorf("rule %s is defined twice", c.Name)
+		}
+		compiled[c.Name] = c
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for name, c := range s.rules {
+		if c.Source == SourceFile {
+			delete(s.rules, name)
+		}
+	}
+	// File rules take precedence over API rules of the same name
+	for name, c := range compiled {
+		s.rules[name] = c
+	}
+	s.modTime = info.ModTime()
+	return nil
+}
+
+// Watch reloads the rules file whenever its modification time changes.
+func (s *Set) Watch(ctx context.Context, path string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			info, err := os.Stat(path)
+			if err != nil {
+				continue
+			}
+			s.mu.RLock()
+			changed := !info.ModTime().Equal(s.modTime)
+			s.mu.RUnlock()
+			if !changed {
+				continue
+			}
+			if err := s.LoadFile(path); err != nil {
+				log.Printf("Warning: keeping previous rules, failed to reload %s: %v", path, err)
+				// Don't retry until the file changes again
+				s.mu.Lock()
+				s.modTime = info.ModTime()
+				s.mu.Unlock()
+				continue
+			}
+			log.Printf("Reloaded rules from %s", path)
+		}
+	}
+}
+
+// Matching returns the rules for symbol whose condition holds.
+func (s *Set) Matching(symbol string, ctx *Context) []Rule {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var out []Rule
+	for _, c := range s.rules {
+		if c.symbols != nil && !c.symbols[symbol] {
+			continue
+		}
+		if c.expr.Eval(ctx) {
+			out = append(out, c.Rule)
+		}
+	}
+	return out
+}
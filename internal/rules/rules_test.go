@@ -0,0 +1,180 @@
+package rules
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Fahadada-code/StockTrader/internal/analytics"
+)
+
+func writeRules(t *testing.T, path, data string, modTime time.Time) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func ruleNames(s *Set) []string {
+	var names []string
+	for _, r := range s.Rules() {
+		names = append(names, r.Name+"/"+r.Source)
+	}
+	return names
+}
+
+func equalNames(got []string, want ...string) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestLoadFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.json")
+	start := time.Now().Add(-time.Hour)
+	writeRules(t, path, `[{"name":"jump","expr":"price_change > 3"},{"name":"shared","expr":"price > 1"}]`, start)
+
+	s := NewSet()
+	if _, err := s.Set(Rule{Name: "mine", Expr: "volume > 0"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Set(Rule{Name: "shared", Expr: "volume > 0"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.LoadFile(path); err != nil {
+		t.Fatal(err)
+	}
+	// File rules win over API rules of the same name
+	if got := ruleNames(s); !equalNames(got, "jump/file", "mine/api", "shared/file") {
+		t.Errorf("rules = %v", got)
+	}
+	if _, err := s.Set(Rule{Name: "jump", Expr: "price > 0"}); err == nil {
+		t.Error("an API rule replaced a file rule")
+	}
+	if err := s.Delete("jump"); err == nil || err == ErrNotFound {
+		t.Errorf("Delete(file rule) = %v, want a conflict", err)
+	}
+	if err := s.Delete("missing"); err != ErrNotFound {
+		t.Errorf("Delete(missing) = %v, want ErrNotFound", err)
+	}
+
+	// A bad file leaves every current rule in place
+	for _, data := range []string{
+		`[{"name":"jump","expr":"price >"}]`,
+		`[{"name":"a","expr":"price > 1"},{"name":"a","expr":"price > 2"}]`,
+		`not json`,
+	} {
+		writeRules(t, path, data, start)
+		if err := s.LoadFile(path); err == nil {
+			t.Errorf("LoadFile(%s) succeeded", data)
+		}
+		if got := ruleNames(s); !equalNames(got, "jump/file", "mine/api", "shared/file") {
+			t.Errorf("after a bad file, rules = %v", got)
+		}
+	}
+
+	// Rules dropped from the file go away; API rules stay
+	writeRules(t, path, `[{"name":"gap","expr":"gap_pct > 2","symbols":["aapl"]}]`, start)
+	if err := s.LoadFile(path); err != nil {
+		t.Fatal(err)
+	}
+	if got := ruleNames(s); !equalNames(got, "gap/file", "mine/api") {
+		t.Errorf("after reload, rules = %v", got)
+	}
+	if r, _ := s.Get("gap"); len(r.Symbols) != 1 || r.Symbols[0] != "AAPL" {
+		t.Errorf("symbols = %v, want [AAPL]", r.Symbols)
+	}
+}
+
+func TestWatchReloads(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.json")
+	start := time.Now().Add(-time.Hour)
+	writeRules(t, path, `[{"name":"first","expr":"price > 1"}]`, start)
+	s := NewSet()
+	if err := s.LoadFile(path); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.Watch(ctx, path, 5*time.Millisecond)
+
+	waitFor := func(want ...string) {
+		t.Helper()
+		deadline := time.Now().Add(2 * time.Second)
+		for !equalNames(ruleNames(s), want...) {
+			if time.Now().After(deadline) {
+				t.Fatalf("rules = %v, want %v", ruleNames(s), want)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+
+	writeRules(t, path, `[{"name":"second","expr":"price > 2"}]`, start.Add(time.Minute))
+	waitFor("second/file")
+
+	// A broken edit keeps the previous rules until the file is fixed
+	writeRules(t, path, `[{"name":"third","expr":"price >"}]`, start.Add(2*time.Minute))
+	time.Sleep(50 * time.Millisecond)
+	waitFor("second/file")
+	writeRules(t, path, `[{"name":"third","expr":"price > 3"}]`, start.Add(3*time.Minute))
+	waitFor("third/file")
+}
+
+func TestDetectorFiresThroughEpisodes(t *testing.T) {
+	s := NewSet()
+	if _, err := s.Set(Rule{Name: "big", Expr: "price > 100", Symbols: []string{"AAPL"}, Severity: analytics.SeverityCritical, Message: "AAPL is above 100"}); err != nil {
+		t.Fatal(err)
+	}
+	d := NewDetector(s, nil)
+	tracker := analytics.NewEpisodeTracker(time.Minute, 5*time.Minute, 0.5)
+	start := time.Date(2024, 1, 2, 15, 0, 0, 0, time.UTC)
+
+	observe := func(symbol string, price float64, at time.Duration) []analytics.Anomaly {
+		var published []analytics.Anomaly
+		for _, a := range d.Detect(analytics.Observation{Symbol: symbol, Tick: analytics.Tick{Price: price}}) {
+			if ev := tracker.Observe(a, start.Add(at)); ev != nil {
+				published = append(published, *ev)
+			}
+		}
+		return published
+	}
+
+	if got := observe("AAPL", 99, 0); len(got) != 0 {
+		t.Errorf("fired below the threshold: %+v", got)
+	}
+	if got := observe("MSFT", 200, 0); len(got) != 0 {
+		t.Errorf("fired for a symbol outside the rule: %+v", got)
+	}
+	got := observe("AAPL", 101, 0)
+	if len(got) != 1 {
+		t.Fatalf("published %d events, want 1", len(got))
+	}
+	if a := got[0]; a.Type != "rule:big" || a.Status != analytics.StatusOpen || a.Severity != analytics.SeverityCritical || a.Details != "AAPL is above 100" || a.Magnitude != 0 {
+		t.Errorf("opened = %+v", a)
+	}
+
+	// Further matches are held back until the cooldown has passed
+	if got := observe("AAPL", 105, 30*time.Second); len(got) != 0 {
+		t.Errorf("published inside the cooldown: %+v", got)
+	}
+	got = observe("AAPL", 105, time.Minute)
+	if len(got) != 1 || got[0].Status != analytics.StatusOngoing {
+		t.Errorf("after the cooldown = %+v, want one ongoing event", got)
+	}
+
+	if resolved := tracker.Sweep(start.Add(7 * time.Minute)); len(resolved) != 1 || resolved[0].Status != analytics.StatusResolved {
+		t.Errorf("resolved = %+v", resolved)
+	}
+}
@@ -28,11 +28,14 @@ type Client struct {
 	manager *Manager
 	conn    *websocket.Conn
 	send    chan Message
+	user    string // set by Manager.Identify, for per-user alerts
 }
 
 type SubscriptionRequest struct {
-	Action string `json:"action"` // "subscribe", "unsubscribe"
+	Action string `json:"action"` // "subscribe", "unsubscribe", "label"
 	Symbol string `json:"symbol"`
+	ID     string `json:"id,omitempty"`    // anomaly to label
+	Label  string `json:"label,omitempty"` // "useful" or "noise"
 }
 
 func (c *Client) readPump() {
@@ -63,6 +66,8 @@ func (c *Client) readPump() {
 			c.manager.Subscribe(c, req.Symbol)
 		case "unsubscribe":
 			c.manager.Unsubscribe(c, req.Symbol)
+		case "label":
+			c.manager.Label(c, req.Symbol, req.ID, req.Label)
 		}
 	}
 }
@@ -108,6 +113,9 @@ func ServeWs(manager *Manager, w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	client := &Client{manager: manager, conn: conn, send: make(chan Message, 256)}
+	if manager.Identify != nil {
+		client.user = manager.Identify(r)
+	}
 	client.manager.register <- client
 
 	go client.writePump()
@@ -2,6 +2,7 @@ package websocket
 
 import (
 	"log"
+	"net/http"
 	"sync"
 )
 
@@ -12,11 +13,23 @@ type Manager struct {
 	unregister chan *Client
 	broadcast  chan Message
 	mu         sync.RWMutex
+
+	// OnSubscribe, if set, returns messages to replay to a client when it
+	// subscribes to a symbol, such as recent anomalies.
+	OnSubscribe func(symbol string) []Message
+
+	// OnLabel, if set, stores a user's feedback label for an anomaly.
+	OnLabel func(id, label string) error
+
+	// Identify, if set, returns the user a connecting client acts as, or ""
+	// for an anonymous client. Only identified clients receive SendToUser
+	// messages.
+	Identify func(r *http.Request) string
 }
 
 type Message struct {
 	Symbol string      `json:"symbol"`
-	Type   string      `json:"type"` // "price", "anomaly", "error"
+	Type   string      `json:"type"` // "price", "anomaly", "candle", "correlation", "spread", "gap", "band_warning", "band_breach", "label", "alert", "error"
 	Data   interface{} `json:"data"`
 }
 
@@ -71,12 +84,46 @@ func (m *Manager) Run() {
 
 func (m *Manager) Subscribe(client *Client, symbol string) {
 	m.mu.Lock()
-	defer m.mu.Unlock()
 	if _, ok := m.symbols[symbol]; !ok {
 		m.symbols[symbol] = make(map[*Client]bool)
 	}
 	m.symbols[symbol][client] = true
+	m.mu.Unlock()
 	log.Printf("Client subscribed to %s", symbol)
+
+	if m.OnSubscribe != nil {
+		m.send(client, m.OnSubscribe(symbol))
+	}
+}
+
+// send delivers messages to a single client if it is still connected.
+func (m *Manager) send(client *Client, messages []Message) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if !m.clients[client] {
+		return
+	}
+	for _, msg := range messages {
+		select {
+		case client.send <- msg:
+		default:
+			log.Printf("Slow client detected, dropping message for %s", msg.Symbol)
+		}
+	}
+}
+
+// Label applies a feedback label and acknowledges it, or reports the error,
+// to the requesting client only.
+func (m *Manager) Label(client *Client, symbol, id, label string) {
+	if m.OnLabel == nil {
+		m.send(client, []Message{{Symbol: symbol, Type: "error", Data: "labelling is not available"}})
+		return
+	}
+	if err := m.OnLabel(id, label); err != nil {
+		m.send(client, []Message{{Symbol: symbol, Type: "error", Data: err.Error()}})
+		return
+	}
+	m.send(client, []Message{{Symbol: symbol, Type: "label", Data: map[string]string{"id": id, "label": label}}})
 }
 
 func (m *Manager) Unsubscribe(client *Client, symbol string) {
@@ -91,6 +138,47 @@ func (m *Manager) Unsubscribe(client *Client, symbol string) {
 	log.Printf("Client unsubscribed from %s", symbol)
 }
 
+// SendToUser delivers a message to every connection opened by user,
+// regardless of their symbol subscriptions.
+func (m *Manager) SendToUser(user string, msg Message) {
+	if user == "" {
+		return
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for client := range m.clients {
+		if client.user != user {
+			continue
+		}
+		select {
+		case client.send <- msg:
+		default:
+			log.Printf("Slow client detected, dropping %s message for %s", msg.Type, user)
+		}
+	}
+}
+
+// BroadcastToSubscribers delivers a message once to every client subscribed
+// to at least one symbol, for data that spans symbols.
+func (m *Manager) BroadcastToSubscribers(msg Message) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	sent := make(map[*Client]bool)
+	for _, subscribers := range m.symbols {
+		for client := range subscribers {
+			if sent[client] {
+				continue
+			}
+			sent[client] = true
+			select {
+			case client.send <- msg:
+			default:
+				log.Printf("Slow client detected, dropping %s message", msg.Type)
+			}
+		}
+	}
+}
+
 func (m *Manager) Broadcast(msg Message) {
 	m.broadcast <- msg
 }
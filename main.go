@@ -2,11 +2,18 @@ package main
 
 import (
 	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"sort"
 	"strconv"
+	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/Fahadada-code/StockTrader/internal/alphavantage"
@@ -15,13 +22,27 @@ import (
 	"github.com/Fahadada-code/StockTrader/internal/db"
 	"github.com/Fahadada-code/StockTrader/internal/ingestion"
 	"github.com/Fahadada-code/StockTrader/internal/metrics"
+	"github.com/Fahadada-code/StockTrader/internal/notify"
 	"github.com/Fahadada-code/StockTrader/internal/resilience"
+	"github.com/Fahadada-code/StockTrader/internal/rules"
 	"github.com/Fahadada-code/StockTrader/internal/websocket"
 
 	"github.com/joho/godotenv"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
+const (
+	analyticsWindow = 50   // rolling window size, in ticks
+	warmUpHistory   = 5000 // stored ticks loaded to seed detector baselines
+	riskFreeRate    = 0.04 // annual rate used for Sharpe and Sortino
+
+	// Backtests run inside the request, so their size is bounded
+	maxBacktestSymbols = 10
+	maxBacktestRange   = 31 * 24 * time.Hour
+	maxBacktestTicks   = 50000 // per symbol
+	backtestTimeout    = 2 * time.Minute
+)
+
 func main() {
 	godotenv.Load()
 
@@ -60,11 +81,74 @@ func main() {
 	// 2. Initialize Components
 	avClient := alphavantage.NewClient(apiKey)
 	wsManager := websocket.NewManager()
-	analyticsEngine := analytics.NewEngine(50) // 50-point rolling window
+	estimator := analytics.EstimatorLogReturn
+	if v := os.Getenv("VOLATILITY_ESTIMATOR"); v != "" {
+		if estimator, err = analytics.ParseVolatilityEstimator(v); err != nil {
+			log.Fatal(err)
+		}
+	}
+	analyticsEngine := analytics.NewEngine(analyticsWindow, estimator)
+	volumeTracker := analytics.NewVolumeTracker()
 	cb := resilience.NewCircuitBreaker(3, 30*time.Second)
 	replayEngine := ingestion.NewReplayEngine(pg)
+	candleAggregator := analytics.NewCandleAggregator(analytics.DefaultResolutions)
+	correlationTracker := analytics.NewCorrelationTracker(240) // 4 hours of 1-minute returns
 
-	activeSymbolsFunc := func() []string {
+	basketEngine := analytics.NewBasketEngine()
+
+	detectors := analytics.DefaultDetectors()
+	gapDetector := analytics.NewGapDetector()
+	detectors.Register(gapDetector, true)
+	ruleSet := rules.NewSet()
+	detectors.Register(rules.NewDetector(ruleSet, func(symbol string) ([]float64, []time.Time) {
+		prices, times, _, _ := analyticsEngine.Series(symbol)
+		return prices, times
+	}), true)
+	rulesFile := os.Getenv("RULES_FILE")
+	if rulesFile != "" {
+		if err := ruleSet.LoadFile(rulesFile); err != nil {
+			log.Fatalf("Invalid RULES_FILE: %v", err)
+		}
+	}
+	if path := os.Getenv("DETECTOR_CONFIG_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			log.Fatalf("Failed to read DETECTOR_CONFIG_FILE: %v", err)
+		}
+		if err := detectors.Configure(data); err != nil {
+			log.Fatalf("Invalid DETECTOR_CONFIG_FILE: %v", err)
+		}
+	}
+	if names := os.Getenv("ANOMALY_DETECTORS"); names != "" {
+		if err := detectors.EnableOnly(strings.Split(names, ",")); err != nil {
+			log.Fatal(err)
+		}
+	}
+	pairMonitor := analytics.NewPairMonitor()
+	alertEngine := analytics.NewAlertEngine()
+
+	bandConfig := analytics.DefaultBandConfig()
+	if path := os.Getenv("BAND_CONFIG_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			log.Fatalf("Failed to read BAND_CONFIG_FILE: %v", err)
+		}
+		if err := json.Unmarshal(data, &bandConfig); err != nil {
+			log.Fatalf("Failed to parse BAND_CONFIG_FILE: %v", err)
+		}
+	}
+	bandMonitor, err := analytics.NewBandMonitor(bandConfig)
+	if err != nil {
+		log.Fatalf("Invalid band configuration: %v", err)
+	}
+
+	benchmark := os.Getenv("BENCHMARK_SYMBOL")
+	if benchmark == "" {
+		benchmark = "SPY"
+	}
+	benchmark = strings.ToUpper(benchmark)
+
+	subscribedSymbolsFunc := func() []string {
 		subs := wsManager.GetSubscribedSymbols()
 		if len(subs) > 0 {
 			return subs
@@ -93,40 +177,668 @@ func main() {
 		return symbols
 	}
 
+	// Baskets and pairs are computed locally, so poll their constituents
+	// instead. The benchmark is always polled so relative metrics have
+	// something to compare to.
+	activeSymbolsFunc := func() []string {
+		symbols := append(subscribedSymbolsFunc(), benchmark)
+		symbols = append(symbols, alertEngine.Symbols()...)
+		return basketEngine.Expand(pairMonitor.Expand(symbols))
+	}
+
+	// A basket name must not shadow a ticker someone is already watching
+	basketEngine.IsSymbol = func(symbol string) bool {
+		if symbol == benchmark {
+			return true
+		}
+		for _, s := range wsManager.GetSubscribedSymbols() {
+			if s == symbol {
+				return true
+			}
+		}
+		for _, s := range alertEngine.Symbols() {
+			if s == symbol {
+				return true
+			}
+		}
+		for _, p := range pairMonitor.Pairs() {
+			if p.Leg1 == symbol || p.Leg2 == symbol {
+				return true
+			}
+		}
+		return false
+	}
+
 	ingestionEngine := ingestion.NewEngine(avClient, 30*time.Second, activeSymbolsFunc, cb)
 
+	// Analytics state is kept in Redis, or in Postgres when Redis is unavailable
+	saveAnalyticsState := func() {
+		for symbol, state := range analyticsEngine.Snapshot() {
+			data, err := json.Marshal(state)
+			if err != nil {
+				continue
+			}
+			if redisAvailable {
+				ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+				err = rc.SetAnalyticsState(ctx, symbol, data)
+				cancel()
+			} else if pg != nil && pg.Conn != nil {
+				err = pg.SaveAnalyticsState(symbol, data)
+			}
+			if err != nil {
+				log.Printf("Warning: failed to save analytics state for %s: %v", symbol, err)
+			}
+		}
+	}
+
+	restoreAnalyticsState := func() {
+		var states map[string][]byte
+		var err error
+		if redisAvailable {
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			states, err = rc.GetAnalyticsStates(ctx)
+			cancel()
+		}
+		if len(states) == 0 && pg != nil && pg.Conn != nil {
+			states, err = pg.GetAnalyticsStates()
+		}
+		if err != nil {
+			log.Printf("Warning: failed to load analytics state: %v", err)
+		}
+		for symbol, data := range states {
+			var state analytics.SymbolState
+			if err := json.Unmarshal(data, &state); err != nil {
+				log.Printf("Warning: discarding corrupt analytics state for %s: %v", symbol, err)
+				continue
+			}
+			analyticsEngine.Restore(symbol, state)
+		}
+		log.Printf("Restored analytics state for %d symbols", len(states))
+	}
+
+	// warmUp loads stored ticks the first time a symbol is seen. They seed
+	// detector baselines, and the rolling window too if no snapshot was restored.
+	warmedUp := make(map[string]bool)
+	var warmUpMu sync.Mutex
+	warmUp := func(symbol string) {
+		warmUpMu.Lock()
+		done := warmedUp[symbol]
+		warmedUp[symbol] = true
+		warmUpMu.Unlock()
+		if done || pg == nil || pg.Conn == nil {
+			return
+		}
+
+		rows, err := pg.GetHistoricalData(symbol, warmUpHistory)
+		if err != nil {
+			log.Printf("Warning: warm-up query for %s failed: %v", symbol, err)
+			return
+		}
+		defer rows.Close()
+
+		var ticks []analytics.Tick
+		var volumes []int64
+		for rows.Next() {
+			var price float64
+			var volume int64
+			var ts time.Time
+			if err := rows.Scan(&price, &volume, &ts); err != nil {
+				continue
+			}
+			ticks = append(ticks, analytics.Tick{Price: price, Time: ts})
+			volumes = append(volumes, volume)
+		}
+		if len(ticks) == 0 {
+			return
+		}
+		// Rows are newest first
+		for i, j := 0, len(ticks)-1; i < j; i, j = i+1, j-1 {
+			ticks[i], ticks[j] = ticks[j], ticks[i]
+			volumes[i], volumes[j] = volumes[j], volumes[i]
+		}
+		// Stored readings go through their own tracker so the live baseline
+		// isn't replaced by stale ones
+		replayVolumes := analytics.NewVolumeTracker()
+		for i := range ticks {
+			ticks[i].Volume = replayVolumes.Delta(symbol, volumes[i], ticks[i].Time.Format("2006-01-02"))
+		}
+
+		detectors.Seed(symbol, ticks)
+		if !analyticsEngine.Has(symbol) {
+			start := 0
+			if len(ticks) > analyticsWindow {
+				start = len(ticks) - analyticsWindow
+			}
+			for _, t := range ticks[start:] {
+				analyticsEngine.Process(symbol, t)
+			}
+		}
+		log.Printf("Warmed up %s from %d stored ticks", symbol, len(ticks))
+	}
+
+	persistBasket := func(b analytics.Basket) error {
+		if pg == nil || pg.Conn == nil {
+			return nil
+		}
+		weights, _ := json.Marshal(b.Weights)
+		var base []byte
+		if b.Base != nil {
+			base, _ = json.Marshal(b.Base)
+		}
+		return pg.SaveBasket(b.Name, weights, base)
+	}
+
+	loadBaskets := func() {
+		var baskets []analytics.Basket
+		if path := os.Getenv("BASKETS_FILE"); path != "" {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				log.Fatalf("Failed to read BASKETS_FILE: %v", err)
+			}
+			if err := json.Unmarshal(data, &baskets); err != nil {
+				log.Fatalf("Failed to parse BASKETS_FILE: %v", err)
+			}
+		}
+		// Baskets saved through the API take precedence over the file
+		if pg != nil && pg.Conn != nil {
+			rows, err := pg.GetBaskets()
+			if err != nil {
+				log.Printf("Warning: failed to load baskets: %v", err)
+			} else {
+				for rows.Next() {
+					var b analytics.Basket
+					var weights, base []byte
+					if err := rows.Scan(&b.Name, &weights, &base); err != nil {
+						continue
+					}
+					json.Unmarshal(weights, &b.Weights)
+					if base != nil {
+						json.Unmarshal(base, &b.Base)
+					}
+					baskets = append(baskets, b)
+				}
+				rows.Close()
+			}
+		}
+		for _, b := range baskets {
+			if err := basketEngine.Set(b); err != nil {
+				log.Printf("Warning: skipping basket %s: %v", b.Name, err)
+			}
+		}
+	}
+
+	loadPairs := func() {
+		if pg == nil || pg.Conn == nil {
+			return
+		}
+		rows, err := pg.GetPairs()
+		if err != nil {
+			log.Printf("Warning: failed to load pairs: %v", err)
+			return
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var config []byte
+			var p analytics.Pair
+			if err := rows.Scan(&config); err != nil || json.Unmarshal(config, &p) != nil {
+				continue
+			}
+			if _, err := pairMonitor.Set(p); err != nil {
+				log.Printf("Warning: skipping pair %s: %v", p.ID(), err)
+			}
+		}
+	}
+
+	loadRules := func() {
+		if pg == nil || pg.Conn == nil {
+			return
+		}
+		rows, err := pg.GetRules()
+		if err != nil {
+			log.Printf("Warning: failed to load rules: %v", err)
+			return
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var config []byte
+			var r rules.Rule
+			if err := rows.Scan(&config); err != nil || json.Unmarshal(config, &r) != nil {
+				continue
+			}
+			if _, err := ruleSet.Set(r); err != nil {
+				log.Printf("Warning: skipping rule %s: %v", r.Name, err)
+			}
+		}
+	}
+
+	loadAlerts := func() {
+		if pg == nil || pg.Conn == nil {
+			return
+		}
+		rows, err := pg.GetAlerts()
+		if err != nil {
+			log.Printf("Warning: failed to load alerts: %v", err)
+			return
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var config []byte
+			var a analytics.Alert
+			if err := rows.Scan(&config); err != nil || json.Unmarshal(config, &a) != nil {
+				continue
+			}
+			if _, err := alertEngine.Set(a); err != nil {
+				log.Printf("Warning: skipping alert %s: %v", a.ID, err)
+			}
+		}
+	}
+
+	persistAlert := func(a analytics.Alert) error {
+		if pg == nil || pg.Conn == nil {
+			return nil
+		}
+		config, _ := json.Marshal(a)
+		return pg.SaveAlert(a.ID, a.User, config)
+	}
+
+	loadBaskets()
+	loadPairs()
+	loadRules()
+	loadAlerts()
+	restoreAnalyticsState()
+	for _, symbol := range activeSymbolsFunc() {
+		warmUp(symbol)
+	}
+
 	// 3. Start Background Routines
 	go wsManager.Run()
 
-	ctx, cancel := context.WithCancel(context.Background())
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer cancel()
 
-	go ingestionEngine.Run(ctx, func(quote *alphavantage.QuoteData) {
+	if rulesFile != "" {
+		go ruleSet.Watch(ctx, rulesFile, 5*time.Second)
+	}
+
+	go func() {
+		ticker := time.NewTicker(5 * time.Minute)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				saveAnalyticsState()
+			}
+		}
+	}()
+
+	// Outbound notifications. Webhooks need the database for their retry queue.
+	notifications := notify.NewHub()
+	var webhooks *notify.WebhookDispatcher
+	if pg != nil && pg.Conn != nil {
+		webhooks = notify.NewWebhookDispatcher(pg)
+		// Internal addresses are refused unless listed, e.g. a local test receiver
+		for _, host := range strings.Split(os.Getenv("WEBHOOK_ALLOWED_HOSTS"), ",") {
+			if host = strings.TrimSpace(host); host != "" {
+				webhooks.AllowedHosts = append(webhooks.AllowedHosts, host)
+			}
+		}
+		if err := webhooks.Load(); err != nil {
+			log.Printf("Warning: failed to load webhooks: %v", err)
+		}
+		webhooks.OnDelivery = func(webhookID, result string, elapsed time.Duration) {
+			metrics.WebhookDeliveries.WithLabelValues(webhookID, result).Inc()
+			metrics.WebhookLatency.WithLabelValues(webhookID).Observe(elapsed.Seconds())
+		}
+		notifications.Add(webhooks)
+		go webhooks.Run(ctx, 2*time.Second)
+	}
+	var email *notify.EmailNotifier
+	if host := os.Getenv("SMTP_HOST"); host != "" {
+		email, err = notify.NewEmailNotifier(notify.SMTPConfig{
+			Host:     host,
+			Port:     os.Getenv("SMTP_PORT"),
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+			From:     os.Getenv("SMTP_FROM"),
+			Security: os.Getenv("SMTP_SECURITY"),
+		}, notify.ParseRecipients(os.Getenv("EMAIL_RECIPIENTS")), os.Getenv("EMAIL_TEXT_TEMPLATE"), os.Getenv("EMAIL_HTML_TEMPLATE"))
+		if err != nil {
+			log.Fatalf("Invalid email configuration: %v", err)
+		}
+		email.Interval = durationEnv("EMAIL_INTERVAL", 5*time.Minute)
+		email.OnSend = func(recipient string, events int, err error) {
+			result := "sent"
+			if err != nil {
+				result = "failed"
+			}
+			metrics.EmailsSent.WithLabelValues(result).Inc()
+			metrics.EmailEvents.WithLabelValues(result).Add(float64(events))
+		}
+		notifications.Add(email)
+		go email.Run(ctx, 5*time.Second)
+	}
+	if amURL := os.Getenv("ALERTMANAGER_URL"); amURL != "" {
+		alertmanager, err := notify.NewAlertmanagerNotifier(amURL)
+		if err != nil {
+			log.Fatalf("Invalid ALERTMANAGER_URL: %v", err)
+		}
+		alertmanager.ResendInterval = durationEnv("ALERTMANAGER_RESEND_INTERVAL", time.Minute)
+		alertmanager.GeneratorURL = os.Getenv("ALERTMANAGER_GENERATOR_URL")
+		alertmanager.OnSend = func(alerts int, err error) {
+			result := "sent"
+			if err != nil {
+				result = "failed"
+			}
+			metrics.AlertmanagerAlerts.WithLabelValues(result).Add(float64(alerts))
+		}
+		notifications.Add(alertmanager)
+		go alertmanager.Run(ctx, 2*time.Second)
+	}
+
+	// Detectors users keep labelling as noise can be muted per symbol by
+	// setting ANOMALY_SUPPRESS_BELOW to a minimum precision
+	feedback := analytics.NewFeedbackTracker(
+		int(floatEnv("ANOMALY_SUPPRESS_MIN_LABELS", 20)),
+		floatEnv("ANOMALY_SUPPRESS_BELOW", 0),
+	)
+	feedback.SuppressFor = durationEnv("ANOMALY_SUPPRESS_FOR", 24*time.Hour)
+	if pg != nil && pg.Conn != nil {
+		if rows, err := pg.GetLabelCounts(); err != nil {
+			log.Printf("Warning: failed to load anomaly labels: %v", err)
+		} else {
+			for rows.Next() {
+				var detector, symbol, label string
+				var n int
+				var last sql.NullTime
+				if err := rows.Scan(&detector, &symbol, &label, &n, &last); err != nil {
+					continue
+				}
+				feedback.Load(detector, symbol, label, n, last.Time)
+			}
+			rows.Close()
+		}
+		for _, p := range feedback.Precisions() {
+			metrics.DetectorPrecision.WithLabelValues(p.Detector, p.Symbol).Set(p.Precision)
+		}
+	}
+
+	// labelAnomaly stores a user's feedback label and updates precision
+	labelAnomaly := func(id, label string) error {
+		if err := analytics.ValidLabel(label); err != nil {
+			return err
+		}
+		if pg == nil || pg.Conn == nil {
+			return errors.New("labelling needs the database")
+		}
+		detector, symbol, previous, err := pg.LabelAnomaly(id, label)
+		if err == sql.ErrNoRows {
+			return errAnomalyNotFound
+		} else if err != nil {
+			return err
+		}
+		p := feedback.Record(detector, symbol, label, previous)
+		metrics.AnomalyLabels.WithLabelValues(detector, symbol, label).Inc()
+		metrics.DetectorPrecision.WithLabelValues(detector, symbol).Set(p.Precision)
+		return nil
+	}
+	wsManager.OnLabel = labelAnomaly
+
+	episodes := analytics.NewEpisodeTracker(
+		durationEnv("ANOMALY_COOLDOWN", 10*time.Minute),
+		durationEnv("ANOMALY_RESOLVE_AFTER", 5*time.Minute),
+		0.5,
+	)
+
+	// emitAnomaly broadcasts an episode event and stores it with the snapshot
+	// of whatever state triggered it (rolling metrics, a spread, ...)
+	emitAnomaly := func(anomaly *analytics.Anomaly, snapshot interface{}) {
+		anomaly.ID = analytics.NewAnomalyID()
+		if anomaly.Status == analytics.StatusOpen {
+			metrics.AnomaliesDetected.WithLabelValues(anomaly.Symbol, anomaly.Type, anomaly.Detector).Inc()
+		}
+		metrics.AnomalyEvents.WithLabelValues(anomaly.Type, anomaly.Status, string(anomaly.Severity)).Inc()
+		wsManager.Broadcast(websocket.Message{
+			Symbol: anomaly.Symbol,
+			Type:   "anomaly",
+			Data:   anomaly,
+		})
+		event := notify.NewEvent("anomaly", anomaly.Symbol, *anomaly)
+		event.Severity = string(anomaly.Severity)
+		event.Message = anomaly.Details
+		notifications.Publish(event)
+		if pg != nil && pg.Conn != nil {
+			var data []byte
+			if snapshot != nil {
+				data, _ = json.Marshal(snapshot)
+			}
+			start := time.Now()
+			err := pg.SaveAnomaly(db.AnomalyRecord{
+				ID:          anomaly.ID,
+				Symbol:      anomaly.Symbol,
+				Type:        anomaly.Type,
+				Detector:    anomaly.Detector,
+				Severity:    string(anomaly.Severity),
+				Status:      anomaly.Status,
+				EpisodeID:   anomaly.EpisodeID,
+				Confidence:  anomaly.Confidence,
+				Description: anomaly.Details,
+				Metrics:     data,
+			})
+			if err != nil {
+				log.Printf("Warning: failed to persist %s anomaly for %s: %v", anomaly.Type, anomaly.Symbol, err)
+			}
+			metrics.DatabaseLatency.Observe(time.Since(start).Seconds())
+		}
+	}
+
+	// publishAnomaly folds a detector finding into its episode, publishing
+	// only new, escalated or reminder events
+	publishAnomaly := func(finding *analytics.Anomaly, snapshot interface{}) {
+		if feedback.Suppressed(finding.Detector, finding.Symbol) {
+			metrics.AnomaliesSuppressed.WithLabelValues(finding.Detector, finding.Symbol).Inc()
+			return
+		}
+		if event := episodes.Observe(*finding, time.Now()); event != nil {
+			emitAnomaly(event, snapshot)
+		}
+	}
+
+	go func() {
+		ticker := time.NewTicker(15 * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				for _, resolved := range episodes.Sweep(now) {
+					emitAnomaly(&resolved, nil)
+				}
+			}
+		}
+	}()
+
+	// Replay the latest anomalies to clients as they subscribe, oldest first
+	wsManager.OnSubscribe = func(symbol string) []websocket.Message {
+		var messages []websocket.Message
+		if g, ok := gapDetector.Gap(symbol); ok {
+			messages = append(messages, websocket.Message{Symbol: symbol, Type: "gap", Data: g})
+		}
+		if pg == nil || pg.Conn == nil {
+			return messages
+		}
+		recent, err := queryAnomalies(pg, db.AnomalyFilter{Symbol: symbol, Limit: 10})
+		if err != nil {
+			log.Printf("Warning: failed to load recent anomalies for %s: %v", symbol, err)
+			return messages
+		}
+		for i := len(recent) - 1; i >= 0; i-- {
+			messages = append(messages, websocket.Message{Symbol: symbol, Type: "anomaly", Data: recent[i]})
+		}
+		return messages
+	}
+
+	publishCandles := func(candles []analytics.Candle) {
+		for _, c := range candles {
+			wsManager.Broadcast(websocket.Message{
+				Symbol: c.Symbol,
+				Type:   "candle",
+				Data:   c,
+			})
+			if pg != nil && pg.Conn != nil {
+				start := time.Now()
+				if err := pg.SaveCandle(c.Symbol, c.Resolution, c.Start, c.Open, c.High, c.Low, c.Close, int64(c.Volume)); err != nil {
+					log.Printf("Warning: failed to persist %s %s candle: %v", c.Symbol, c.Resolution, err)
+				}
+				metrics.DatabaseLatency.Observe(time.Since(start).Seconds())
+			}
+		}
+	}
+
+	// Close bars on their time boundaries even if a symbol stops ticking
+	go func() {
+		ticker := time.NewTicker(5 * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				publishCandles(candleAggregator.Flush(now))
+			}
+		}
+	}()
+
+	// Sample returns on a common clock and publish the correlation matrix
+	go func() {
+		ticker := time.NewTicker(1 * time.Minute)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				correlationTracker.Sample()
+				breakdowns := correlationTracker.Breakdowns(120, 15, 0.7, 0.5)
+				for i := range breakdowns {
+					publishAnomaly(&breakdowns[i], nil)
+				}
+
+				symbols := wsManager.GetSubscribedSymbols()
+				if len(symbols) < 2 {
+					continue
+				}
+				sort.Strings(symbols)
+				// One matrix per sampling tick, sent once to each subscriber
+				wsManager.BroadcastToSubscribers(websocket.Message{
+					Type: "correlation",
+					Data: correlationTracker.Matrix(symbols, 30),
+				})
+			}
+		}
+	}()
+
+	var processQuote func(quote *alphavantage.QuoteData)
+	processQuote = func(quote *alphavantage.QuoteData) {
 		price, _ := strconv.ParseFloat(quote.Price, 64)
 		volume, _ := strconv.ParseInt(quote.Volume, 10, 64)
 
 		// A. Analytics Processing
-		m := analyticsEngine.Process(quote.Symbol, price, float64(volume))
+		warmUp(quote.Symbol)
+		// Volume is cumulative for the session; analytics work on interval volume
+		intervalVolume := volumeTracker.Delta(quote.Symbol, volume, quote.LatestTradingDay)
+		tick := newTick(quote, intervalVolume)
+		m := analyticsEngine.Process(quote.Symbol, tick)
+		if quote.Symbol != benchmark {
+			if rel, ok := correlationTracker.Relative(quote.Symbol, benchmark, 60); ok {
+				m.Relative = &rel
+			}
+		}
 		metrics.UpdatesProcessed.WithLabelValues(quote.Symbol).Inc()
 
 		// B. Anomaly Detection
-		if anomaly := analytics.DetectAnomaly(quote.Symbol, price, float64(volume), m); anomaly != nil {
-			metrics.AnomaliesDetected.WithLabelValues(quote.Symbol, anomaly.Type).Inc()
+		previousClose, _ := strconv.ParseFloat(quote.PreviousClose, 64)
+		anomalies := detectors.Run(analytics.Observation{
+			Symbol:        quote.Symbol,
+			Tick:          tick,
+			PreviousClose: previousClose,
+			TradingDay:    quote.LatestTradingDay,
+			Metrics:       m,
+		})
+		for i := range anomalies {
+			publishAnomaly(&anomalies[i], m)
+		}
+		for _, t := range alertEngine.Evaluate(quote.Symbol, price, previousClose, time.Now()) {
+			metrics.AlertsTriggered.WithLabelValues(quote.Symbol, t.Alert.Condition).Inc()
+			wsManager.SendToUser(t.Alert.User, websocket.Message{
+				Symbol: quote.Symbol,
+				Type:   "alert",
+				Data:   t,
+			})
+			event := notify.NewEvent("alert", quote.Symbol, t)
+			event.User = t.Alert.User
+			event.Message = t.Message
+			notifications.Publish(event)
+			if err := persistAlert(t.Alert); err != nil {
+				log.Printf("Warning: failed to persist alert %s: %v", t.Alert.ID, err)
+			}
+		}
+		if g, ok := gapDetector.Gap(quote.Symbol); ok && g.TradingDay == quote.LatestTradingDay {
 			wsManager.Broadcast(websocket.Message{
 				Symbol: quote.Symbol,
-				Type:   "anomaly",
-				Data:   anomaly,
+				Type:   "gap",
+				Data:   g,
 			})
 		}
+		correlationTracker.Observe(quote.Symbol, price)
+		spreads, spreadAnomalies := pairMonitor.Update(quote.Symbol, price)
+		for _, u := range spreads {
+			wsManager.Broadcast(websocket.Message{
+				Symbol: u.Pair,
+				Type:   "spread",
+				Data:   u,
+			})
+		}
+		for i := range spreadAnomalies {
+			var snapshot interface{}
+			for _, u := range spreads {
+				if u.Pair == spreadAnomalies[i].Symbol {
+					snapshot = u
+				}
+			}
+			publishAnomaly(&spreadAnomalies[i], snapshot)
+		}
+
+		// Limit-up/limit-down bands only apply to traded symbols
+		if !basketEngine.IsBasket(quote.Symbol) {
+			band, changed := bandMonitor.Update(quote.Symbol, price, tick.Time)
+			if band.Symbol != "" {
+				metrics.BandUsage.WithLabelValues(quote.Symbol).Set(band.Usage)
+			}
+			if changed {
+				eventType := "band_" + band.State
+				metrics.BandEvents.WithLabelValues(quote.Symbol, eventType).Inc()
+				wsManager.Broadcast(websocket.Message{
+					Symbol: quote.Symbol,
+					Type:   eventType,
+					Data:   band,
+				})
+			}
+		}
+
+		// C. Candle Aggregation
+		publishCandles(candleAggregator.Add(quote.Symbol, price, intervalVolume, time.Now()))
 
-		// C. Snapshot Persistence
+		// D. Snapshot Persistence
 		if pg != nil && pg.Conn != nil {
 			start := time.Now()
 			pg.SaveQuote(quote.Symbol, price, volume)
 			metrics.DatabaseLatency.Observe(time.Since(start).Seconds())
 		}
 
-		// D. Real-Time Distribution (including analytics metrics)
+		// E. Real-Time Distribution (including analytics metrics)
 		wsManager.Broadcast(websocket.Message{
 			Symbol: quote.Symbol,
 			Type:   "price",
@@ -138,14 +850,33 @@ func main() {
 				Metrics: m,
 			},
 		})
-	})
+
+		// F. Synthetic Indices
+		for _, v := range basketEngine.Update(quote.Symbol, price, volume, quote.LatestTradingDay) {
+			if v.Rebased {
+				if b, ok := basketEngine.Get(v.Name); ok {
+					if err := persistBasket(b); err != nil {
+						log.Printf("Warning: failed to persist basket %s: %v", b.Name, err)
+					}
+				}
+			}
+			processQuote(&alphavantage.QuoteData{
+				Symbol:           v.Name,
+				Price:            strconv.FormatFloat(v.Value, 'f', 4, 64),
+				Volume:           strconv.FormatInt(v.Volume, 10),
+				LatestTradingDay: v.TradingDay,
+			})
+		}
+	}
+
+	go ingestionEngine.Run(ctx, processQuote)
 
 	// 4. HTTP Handlers
 	enableCORS := func(next http.HandlerFunc) http.HandlerFunc {
 		return func(w http.ResponseWriter, r *http.Request) {
 			w.Header().Set("Access-Control-Allow-Origin", "*")
-			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-			w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, DELETE, OPTIONS")
+			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
 			if r.Method == "OPTIONS" {
 				return
 			}
@@ -153,6 +884,40 @@ func main() {
 		}
 	}
 
+	// Per-user features (price alerts) need to know who is calling. With
+	// USER_TOKENS ("token=user,...") set, the user comes from a bearer token,
+	// or a ?token= parameter for browser websockets. Only with DEV_MODE set
+	// may a caller instead name itself with ?user=, which is no security
+	// boundary.
+	userTokens := make(map[string]string)
+	for _, pair := range strings.Split(os.Getenv("USER_TOKENS"), ",") {
+		if token, user, ok := strings.Cut(strings.TrimSpace(pair), "="); ok && token != "" && user != "" {
+			userTokens[token] = user
+		}
+	}
+	devMode := boolEnv("DEV_MODE", false)
+	switch {
+	case len(userTokens) > 0:
+	case devMode:
+		log.Printf("Warning: DEV_MODE is set and USER_TOKENS is not; alert owners are taken from ?user= without authentication")
+	default:
+		log.Printf("Warning: USER_TOKENS is not set; per-user alerts are disabled")
+	}
+	identify := func(r *http.Request) string {
+		if len(userTokens) == 0 {
+			if devMode {
+				return r.URL.Query().Get("user")
+			}
+			return ""
+		}
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if token == "" || token == r.Header.Get("Authorization") {
+			token = r.URL.Query().Get("token")
+		}
+		return userTokens[token]
+	}
+	wsManager.Identify = identify
+
 	http.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
 		websocket.ServeWs(wsManager, w, r)
 		metrics.ActiveConnections.Inc()
@@ -174,9 +939,8 @@ func main() {
 			return
 		}
 
-		price, _ := strconv.ParseFloat(quote.Price, 64)
 		volume, _ := strconv.ParseInt(quote.Volume, 10, 64)
-		m := analyticsEngine.Process(quote.Symbol, price, float64(volume))
+		m := analyticsEngine.Process(quote.Symbol, newTick(quote, volumeTracker.Delta(quote.Symbol, volume, quote.LatestTradingDay)))
 
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(struct {
@@ -233,20 +997,986 @@ func main() {
 		w.Write([]byte(`{"status":"replay started"}`))
 	}))
 
-	http.Handle("/metrics", promhttp.Handler())
+	http.HandleFunc("/api/correlation", enableCORS(func(w http.ResponseWriter, r *http.Request) {
+		symbols := correlationTracker.Symbols()
+		if s := r.URL.Query().Get("symbols"); s != "" {
+			symbols = nil
+			for _, symbol := range strings.Split(strings.ToUpper(s), ",") {
+				if symbol = strings.TrimSpace(symbol); symbol != "" {
+					symbols = append(symbols, symbol)
+				}
+			}
+		}
+		window := 30
+		if windowStr := r.URL.Query().Get("window"); windowStr != "" {
+			n, err := strconv.Atoi(windowStr)
+			if err != nil || n < 3 {
+				http.Error(w, "window must be an integer of at least 3", http.StatusBadRequest)
+				return
+			}
+			window = n
+		}
 
-	http.HandleFunc("/api/health", enableCORS(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
-		w.Write([]byte(`{"status":"up"}`))
+		json.NewEncoder(w).Encode(correlationTracker.Matrix(symbols, window))
 	}))
 
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
-	}
+	http.HandleFunc("/api/relative", enableCORS(func(w http.ResponseWriter, r *http.Request) {
+		symbol := strings.ToUpper(r.URL.Query().Get("symbol"))
+		if symbol == "" {
+			http.Error(w, "symbol is required", http.StatusBadRequest)
+			return
+		}
+		bench := benchmark
+		if b := r.URL.Query().Get("benchmark"); b != "" {
+			bench = strings.ToUpper(b)
+		}
+		window := 60
+		if windowStr := r.URL.Query().Get("window"); windowStr != "" {
+			n, err := strconv.Atoi(windowStr)
+			if err != nil || n < 3 {
+				http.Error(w, "window must be an integer of at least 3", http.StatusBadRequest)
+				return
+			}
+			window = n
+		}
+
+		rel, ok := correlationTracker.Relative(symbol, bench, window)
+		if !ok {
+			http.Error(w, "not enough aligned returns for "+symbol+" and "+bench, http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(rel)
+	}))
+
+	http.HandleFunc("/api/risk", enableCORS(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		symbol := strings.ToUpper(q.Get("symbol"))
+		if symbol == "" {
+			http.Error(w, "symbol is required", http.StatusBadRequest)
+			return
+		}
+		horizon := 1
+		if h := q.Get("horizon"); h != "" {
+			n, err := strconv.Atoi(h)
+			if err != nil || n < 1 {
+				http.Error(w, "horizon must be a positive integer", http.StatusBadRequest)
+				return
+			}
+			horizon = n
+		}
+		confidence := 0.95
+		if c := q.Get("confidence"); c != "" {
+			f, err := strconv.ParseFloat(c, 64)
+			if err != nil || f <= 0 || f >= 1 {
+				http.Error(w, "confidence must be between 0 and 1", http.StatusBadRequest)
+				return
+			}
+			confidence = f
+		}
+		source := q.Get("source")
+		if source == "" {
+			source = "daily"
+		}
+
+		var prices []float64
+		var times []time.Time
+		var periodsPerYear float64
+		switch source {
+		case "daily":
+			periodsPerYear = 252
+			if pg != nil && pg.Conn != nil {
+				rows, err := pg.GetDailyCloses(symbol, 252)
+				if err != nil {
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+					return
+				}
+				for rows.Next() {
+					var day time.Time
+					var price float64
+					if err := rows.Scan(&day, &price); err != nil {
+						continue
+					}
+					prices = append(prices, price)
+					times = append(times, day)
+				}
+				err = rows.Err()
+				rows.Close()
+				if err != nil {
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+					return
+				}
+			}
+			// Alpha Vantage is only asked when too few days are stored
+			if len(prices) > analytics.MinRiskReturns {
+				break
+			}
+			history, err := avClient.GetDailyHistory(symbol)
+			if err != nil {
+				if err.Error() == "rate limit reached or history not found" {
+					http.Error(w, err.Error(), http.StatusTooManyRequests)
+				} else {
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+				}
+				return
+			}
+			prices, times = dailyCloses(history)
+		case "live":
+			var ok bool
+			prices, times, periodsPerYear, ok = analyticsEngine.Series(symbol)
+			if !ok {
+				http.Error(w, "no live data for "+symbol, http.StatusNotFound)
+				return
+			}
+		default:
+			http.Error(w, "source must be daily or live", http.StatusBadRequest)
+			return
+		}
+
+		report, err := analytics.ComputeRisk(prices, times, periodsPerYear, horizon, confidence, riskFreeRate)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+		report.Symbol = symbol
+		report.Source = source
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(report)
+	}))
+
+	http.HandleFunc("/api/forecast", enableCORS(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		symbol := strings.ToUpper(q.Get("symbol"))
+		if symbol == "" {
+			http.Error(w, "symbol is required", http.StatusBadRequest)
+			return
+		}
+		opts := analytics.ForecastOptions{Model: q.Get("model"), Horizon: 5, Confidence: 0.95}
+		if opts.Model == "" {
+			opts.Model = analytics.ModelHoltWinters
+		}
+		limits := map[string]struct {
+			dst *int
+			max int
+		}{
+			"horizon": {&opts.Horizon, analytics.MaxForecastHorizon},
+			"season":  {&opts.Season, analytics.MaxForecastSeason},
+			"order":   {&opts.Order, analytics.MaxForecastOrder},
+		}
+		for name, l := range limits {
+			if v := q.Get(name); v != "" {
+				n, err := strconv.Atoi(v)
+				if err != nil || n < 0 || n > l.max {
+					http.Error(w, name+" must be an integer between 0 and "+strconv.Itoa(l.max), http.StatusBadRequest)
+					return
+				}
+				*l.dst = n
+			}
+		}
+		if c := q.Get("confidence"); c != "" {
+			f, err := strconv.ParseFloat(c, 64)
+			if err != nil {
+				http.Error(w, "confidence must be a number", http.StatusBadRequest)
+				return
+			}
+			opts.Confidence = f
+		}
+
+		// Daily bars come from Alpha Vantage; intraday bars from stored candles
+		var series []float64
+		resolution := q.Get("resolution")
+		if resolution == "" || resolution == "1d" {
+			resolution = "1d"
+			history, err := avClient.GetDailyHistory(symbol)
+			if err != nil {
+				if err.Error() == "rate limit reached or history not found" {
+					http.Error(w, err.Error(), http.StatusTooManyRequests)
+				} else {
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+				}
+				return
+			}
+			series, _ = dailyCloses(history)
+		} else {
+			if pg == nil || pg.Conn == nil {
+				http.Error(w, "intraday forecasts need the database", http.StatusServiceUnavailable)
+				return
+			}
+			rows, err := pg.GetCandles(symbol, resolution, 500)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			defer rows.Close()
+			for rows.Next() {
+				var start time.Time
+				var open, high, low, close float64
+				var volume int64
+				if err := rows.Scan(&start, &open, &high, &low, &close, &volume); err != nil {
+					continue
+				}
+				series = append(series, close)
+			}
+			// Rows are newest first
+			for i, j := 0, len(series)-1; i < j; i, j = i+1, j-1 {
+				series[i], series[j] = series[j], series[i]
+			}
+		}
+
+		forecast, err := analytics.ForecastSeries(series, opts)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(struct {
+			Symbol     string `json:"symbol"`
+			Resolution string `json:"resolution"`
+			analytics.Forecast
+		}{symbol, resolution, forecast})
+	}))
+
+	http.HandleFunc("/api/anomalies", enableCORS(func(w http.ResponseWriter, r *http.Request) {
+		if pg == nil || pg.Conn == nil {
+			http.Error(w, "anomaly history needs the database", http.StatusServiceUnavailable)
+			return
+		}
+		q := r.URL.Query()
+		filter := db.AnomalyFilter{
+			Symbol: strings.ToUpper(q.Get("symbol")),
+			Type:   q.Get("type"),
+			Limit:  50,
+		}
+		for name, dst := range map[string]*time.Time{"from": &filter.From, "to": &filter.To} {
+			if v := q.Get(name); v != "" {
+				t, err := time.Parse(time.RFC3339, v)
+				if err != nil {
+					http.Error(w, name+" must be an RFC 3339 timestamp", http.StatusBadRequest)
+					return
+				}
+				*dst = t
+			}
+		}
+		for name, dst := range map[string]*int{"limit": &filter.Limit, "offset": &filter.Offset} {
+			if v := q.Get(name); v != "" {
+				n, err := strconv.Atoi(v)
+				if err != nil || n < 0 {
+					http.Error(w, name+" must be a non-negative integer", http.StatusBadRequest)
+					return
+				}
+				*dst = n
+			}
+		}
+		if filter.Limit == 0 || filter.Limit > 500 {
+			filter.Limit = 500
+		}
+
+		anomalies, err := queryAnomalies(pg, filter)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(struct {
+			Anomalies  []storedAnomaly `json:"anomalies"`
+			Limit      int             `json:"limit"`
+			Offset     int             `json:"offset"`
+			NextOffset *int            `json:"next_offset"` // null on the last page
+		}{
+			Anomalies:  anomalies,
+			Limit:      filter.Limit,
+			Offset:     filter.Offset,
+			NextOffset: nextOffset(filter, len(anomalies)),
+		})
+	}))
+
+	http.HandleFunc("/api/detectors", enableCORS(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			enabled, err := strconv.ParseBool(r.URL.Query().Get("enabled"))
+			if err != nil {
+				http.Error(w, "enabled must be true or false", http.StatusBadRequest)
+				return
+			}
+			if err := detectors.SetEnabled(r.URL.Query().Get("name"), enabled); err != nil {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(detectors.Statuses())
+	}))
+
+	http.HandleFunc("/api/baskets", enableCORS(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(basketEngine.Baskets())
+		case http.MethodPost:
+			var b analytics.Basket
+			if err := json.NewDecoder(r.Body).Decode(&b); err != nil {
+				http.Error(w, "invalid basket: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			b.Base = nil
+			name := strings.ToUpper(b.Name)
+			previous, existed := basketEngine.Get(name)
+			if err := basketEngine.Set(b); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			b, _ = basketEngine.Get(name)
+			if err := persistBasket(b); err != nil {
+				// Roll back so the live basket matches what is stored
+				if existed {
+					basketEngine.Set(previous)
+				} else {
+					basketEngine.Delete(name)
+				}
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(b)
+		case http.MethodDelete:
+			name := strings.ToUpper(r.URL.Query().Get("name"))
+			if !basketEngine.IsBasket(name) {
+				http.Error(w, "basket not found", http.StatusNotFound)
+				return
+			}
+			if pg != nil && pg.Conn != nil {
+				if err := pg.DeleteBasket(name); err != nil {
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+					return
+				}
+			}
+			basketEngine.Delete(name)
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	}))
+
+	http.HandleFunc("/api/pairs", enableCORS(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(pairMonitor.Pairs())
+		case http.MethodPost:
+			var p analytics.Pair
+			if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+				http.Error(w, "invalid pair: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			p, err := pairMonitor.Set(p)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if pg != nil && pg.Conn != nil {
+				config, _ := json.Marshal(p)
+				if err := pg.SavePair(p.ID(), config); err != nil {
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+					return
+				}
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(p)
+		case http.MethodDelete:
+			id := strings.ToUpper(r.URL.Query().Get("id"))
+			found := false
+			for _, p := range pairMonitor.Pairs() {
+				found = found || p.ID() == id
+			}
+			if !found {
+				http.Error(w, "pair not found", http.StatusNotFound)
+				return
+			}
+			if pg != nil && pg.Conn != nil {
+				if err := pg.DeletePair(id); err != nil {
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+					return
+				}
+			}
+			pairMonitor.Delete(id)
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	}))
+
+	http.HandleFunc("/api/anomalies/label", enableCORS(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		q := r.URL.Query()
+		if err := labelAnomaly(q.Get("id"), q.Get("label")); err != nil {
+			status := http.StatusInternalServerError
+			switch {
+			case analytics.ValidLabel(q.Get("label")) != nil:
+				status = http.StatusBadRequest
+			case pg == nil || pg.Conn == nil:
+				status = http.StatusServiceUnavailable
+			case err == errAnomalyNotFound:
+				status = http.StatusNotFound
+			}
+			http.Error(w, err.Error(), status)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	http.HandleFunc("/api/anomalies/precision", enableCORS(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(feedback.Precisions())
+	}))
+
+	// Lifts a suppression before it expires
+	http.HandleFunc("/api/anomalies/unsuppress", enableCORS(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		q := r.URL.Query()
+		if !feedback.Unsuppress(q.Get("detector"), strings.ToUpper(q.Get("symbol"))) {
+			http.Error(w, "detector is not suppressed for that symbol", http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	http.HandleFunc("/api/backtest", enableCORS(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if pg == nil || pg.Conn == nil {
+			http.Error(w, "backtesting needs the database", http.StatusServiceUnavailable)
+			return
+		}
+		var req struct {
+			Symbols      []string                   `json:"symbols"`
+			From         time.Time                  `json:"from"`
+			To           time.Time                  `json:"to"`
+			Detectors    []string                   `json:"detectors"` // defaults to the live selection
+			Config       map[string]json.RawMessage `json:"config"`    // overrides the live detector configuration
+			Labels       []analytics.LabelledEvent  `json:"labels"`
+			Tolerance    string                     `json:"tolerance"`
+			Cooldown     string                     `json:"cooldown"`
+			ResolveAfter string                     `json:"resolve_after"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid backtest request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if len(req.Symbols) == 0 || len(req.Symbols) > maxBacktestSymbols {
+			http.Error(w, "between 1 and "+strconv.Itoa(maxBacktestSymbols)+" symbols are required", http.StatusBadRequest)
+			return
+		}
+		for i := range req.Labels {
+			req.Labels[i].Symbol = strings.ToUpper(req.Labels[i].Symbol)
+		}
+		if req.To.IsZero() {
+			req.To = time.Now()
+		}
+		if req.From.IsZero() {
+			req.From = req.To.Add(-7 * 24 * time.Hour)
+		}
+		if !req.From.Before(req.To) || req.To.Sub(req.From) > maxBacktestRange {
+			http.Error(w, "from must be before to and at most 31 days earlier", http.StatusBadRequest)
+			return
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), backtestTimeout)
+		defer cancel()
+		opts := analytics.BacktestOptions{
+			Cooldown:     episodes.Cooldown,
+			ResolveAfter: episodes.ResolveAfter,
+			Tolerance:    5 * time.Minute,
+			MaxEvents:    500,
+		}
+		for _, d := range []struct {
+			name  string
+			value string
+			dst   *time.Duration
+		}{
+			{"tolerance", req.Tolerance, &opts.Tolerance},
+			{"cooldown", req.Cooldown, &opts.Cooldown},
+			{"resolve_after", req.ResolveAfter, &opts.ResolveAfter},
+		} {
+			if d.value == "" {
+				continue
+			}
+			v, err := time.ParseDuration(d.value)
+			if err != nil || v < 0 {
+				http.Error(w, d.name+" must be a non-negative duration", http.StatusBadRequest)
+				return
+			}
+			*d.dst = v
+		}
+
+		// Candidate parameters are layered over the live configuration
+		engine := analytics.NewEngine(analyticsWindow, estimator)
+		candidates := analytics.DefaultDetectors()
+		candidates.Register(analytics.NewGapDetector(), true)
+		candidates.Register(rules.NewDetector(ruleSet, func(symbol string) ([]float64, []time.Time) {
+			prices, times, _, _ := engine.Series(symbol)
+			return prices, times
+		}), true)
+		liveConfig := make(map[string]analytics.Detector)
+		var enabled []string
+		for _, s := range detectors.Statuses() {
+			liveConfig[s.Name] = s.Config
+			if s.Enabled {
+				enabled = append(enabled, s.Name)
+			}
+		}
+		if req.Detectors != nil {
+			enabled = req.Detectors
+		}
+		baseConfig, _ := json.Marshal(liveConfig)
+		if err := candidates.Configure(baseConfig); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if req.Config != nil {
+			candidateConfig, _ := json.Marshal(req.Config)
+			if err := candidates.Configure(candidateConfig); err != nil {
+				http.Error(w, "invalid detector configuration: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		if err := candidates.EnableOnly(enabled); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		history := make(map[string][]analytics.Tick)
+		for _, symbol := range req.Symbols {
+			symbol = strings.ToUpper(symbol)
+			rows, err := pg.GetMarketDataRange(ctx, symbol, req.From, req.To, maxBacktestTicks)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			tracker := analytics.NewVolumeTracker()
+			var ticks []analytics.Tick
+			for rows.Next() {
+				var price float64
+				var volume int64
+				var ts time.Time
+				if err := rows.Scan(&price, &volume, &ts); err != nil {
+					continue
+				}
+				ticks = append(ticks, analytics.Tick{
+					Price:  price,
+					Volume: tracker.Delta(symbol, volume, ts.Format("2006-01-02")),
+					Time:   ts,
+				})
+			}
+			err = rows.Err()
+			rows.Close()
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			history[symbol] = ticks
+		}
+
+		report, err := analytics.Backtest(ctx, history, engine, candidates, req.Labels, opts)
+		if err != nil {
+			http.Error(w, "backtest did not finish: "+err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(report)
+	}))
+
+	http.HandleFunc("/api/bands", enableCORS(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(bandMonitor.Statuses())
+	}))
+
+	http.HandleFunc("/api/alerts", enableCORS(func(w http.ResponseWriter, r *http.Request) {
+		user := identify(r)
+		if user == "" {
+			http.Error(w, "unknown user", http.StatusUnauthorized)
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(alertEngine.Alerts(user))
+		case http.MethodPost:
+			var a analytics.Alert
+			if err := json.NewDecoder(r.Body).Decode(&a); err != nil {
+				http.Error(w, "invalid alert: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			a.User = user
+			a, err := alertEngine.Set(a)
+			if err == analytics.ErrAlertNotFound {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			} else if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if err := persistAlert(a); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(a)
+		case http.MethodDelete:
+			id := r.URL.Query().Get("id")
+			owned := false
+			for _, a := range alertEngine.Alerts(user) {
+				owned = owned || a.ID == id
+			}
+			if !owned {
+				http.Error(w, analytics.ErrAlertNotFound.Error(), http.StatusNotFound)
+				return
+			}
+			if pg != nil && pg.Conn != nil {
+				if err := pg.DeleteAlert(id); err != nil {
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+					return
+				}
+			}
+			alertEngine.Delete(id, user)
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	}))
+
+	requireWebhooks := func(w http.ResponseWriter) bool {
+		if webhooks == nil {
+			http.Error(w, "webhooks need the database", http.StatusServiceUnavailable)
+			return false
+		}
+		return true
+	}
+
+	http.HandleFunc("/api/webhooks", enableCORS(func(w http.ResponseWriter, r *http.Request) {
+		if !requireWebhooks(w) {
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(webhooks.Webhooks())
+		case http.MethodPost:
+			var hook notify.Webhook
+			if err := json.NewDecoder(r.Body).Decode(&hook); err != nil {
+				http.Error(w, "invalid webhook: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			hook, err := webhooks.Set(hook)
+			if err == notify.ErrWebhookNotFound {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			} else if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(hook)
+		case http.MethodDelete:
+			if err := webhooks.Delete(r.URL.Query().Get("id")); err == notify.ErrWebhookNotFound {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			} else if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	}))
+
+	http.HandleFunc("/api/webhooks/test", enableCORS(func(w http.ResponseWriter, r *http.Request) {
+		if !requireWebhooks(w) {
+			return
+		}
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		result, err := webhooks.Test(r.Context(), r.URL.Query().Get("id"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(result)
+	}))
+
+	// Dead-lettered deliveries: GET lists them, POST ?id= puts one back on the queue
+	http.HandleFunc("/api/webhooks/dead", enableCORS(func(w http.ResponseWriter, r *http.Request) {
+		if !requireWebhooks(w) {
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			dead, err := webhooks.DeadDeliveries(r.URL.Query().Get("webhook"), 100)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(dead)
+		case http.MethodPost:
+			id, err := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+			if err != nil {
+				http.Error(w, "id must be an integer", http.StatusBadRequest)
+				return
+			}
+			ok, err := webhooks.Requeue(id)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			if !ok {
+				http.Error(w, "dead delivery not found", http.StatusNotFound)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	}))
+
+	// Sends a test email to one recipient, bypassing the digest rate limit
+	http.HandleFunc("/api/email/test", enableCORS(func(w http.ResponseWriter, r *http.Request) {
+		if email == nil {
+			http.Error(w, "email is not configured", http.StatusServiceUnavailable)
+			return
+		}
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if err := email.Test(r.URL.Query().Get("user")); err == notify.ErrRecipientNotFound {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	http.HandleFunc("/api/rules", enableCORS(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(ruleSet.Rules())
+		case http.MethodPost:
+			var rule rules.Rule
+			if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+				http.Error(w, "invalid rule: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			rule, err := ruleSet.Set(rule)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if pg != nil && pg.Conn != nil {
+				config, _ := json.Marshal(rule)
+				if err := pg.SaveRule(rule.Name, config); err != nil {
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+					return
+				}
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(rule)
+		case http.MethodDelete:
+			name := r.URL.Query().Get("name")
+			rule, ok := ruleSet.Get(name)
+			if !ok {
+				http.Error(w, rules.ErrNotFound.Error(), http.StatusNotFound)
+				return
+			}
+			if rule.Source == rules.SourceFile {
+				http.Error(w, "rule "+name+" is managed by the rules file", http.StatusConflict)
+				return
+			}
+			if pg != nil && pg.Conn != nil {
+				if err := pg.DeleteRule(name); err != nil {
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+					return
+				}
+			}
+			ruleSet.Delete(name)
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	}))
+
+	http.HandleFunc("/api/rules/validate", enableCORS(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := rules.Compile(r.URL.Query().Get("expr")); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"valid":true}`))
+	}))
+
+	http.Handle("/metrics", promhttp.Handler())
+
+	http.HandleFunc("/api/health", enableCORS(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"status":"up"}`))
+	}))
+
+	port := os.Getenv("PORT")
+	if port == "" {
+		port = "8080"
+	}
+
+	srv := &http.Server{Addr: ":" + port}
+	go func() {
+		log.Printf("StockTrader Pro Backend starting on port %s", port)
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatal(err)
+		}
+	}()
+
+	<-ctx.Done()
+	log.Println("Shutting down, saving analytics state...")
+	saveAnalyticsState()
+
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelShutdown()
+	srv.Shutdown(shutdownCtx)
+}
+
+func newTick(quote *alphavantage.QuoteData, volume float64) analytics.Tick {
+	price, _ := strconv.ParseFloat(quote.Price, 64)
+	open, _ := strconv.ParseFloat(quote.Open, 64)
+	high, _ := strconv.ParseFloat(quote.High, 64)
+	low, _ := strconv.ParseFloat(quote.Low, 64)
+	return analytics.Tick{
+		Price:  price,
+		Volume: volume,
+		Open:   open,
+		High:   high,
+		Low:    low,
+		Time:   time.Now(),
+	}
+}
+
+// dailyCloses orders a daily history by date and returns its closing prices.
+func dailyCloses(history map[string]alphavantage.DailyData) ([]float64, []time.Time) {
+	dates := make([]string, 0, len(history))
+	for date := range history {
+		dates = append(dates, date)
+	}
+	sort.Strings(dates)
+
+	prices := make([]float64, 0, len(dates))
+	times := make([]time.Time, 0, len(dates))
+	for _, date := range dates {
+		t, err := time.Parse("2006-01-02", date)
+		if err != nil {
+			continue
+		}
+		c, err := strconv.ParseFloat(history[date].Close, 64)
+		if err != nil {
+			continue
+		}
+		prices = append(prices, c)
+		times = append(times, t)
+	}
+	return prices, times
+}
+
+var errAnomalyNotFound = errors.New("anomaly not found")
+
+func floatEnv(name string, fallback float64) float64 {
+	v := os.Getenv(name)
+	if v == "" {
+		return fallback
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		log.Fatalf("Invalid %s: %v", name, err)
+	}
+	return f
+}
+
+func boolEnv(name string, fallback bool) bool {
+	v := os.Getenv(name)
+	if v == "" {
+		return fallback
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		log.Fatalf("Invalid %s: %v", name, err)
+	}
+	return b
+}
+
+func durationEnv(name string, fallback time.Duration) time.Duration {
+	v := os.Getenv(name)
+	if v == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		log.Fatalf("Invalid %s: %v", name, err)
+	}
+	return d
+}
+
+// storedAnomaly is an anomaly read back from the database.
+type storedAnomaly struct {
+	ID         string          `json:"id"`
+	Symbol     string          `json:"symbol"`
+	Type       string          `json:"type"`
+	Detector   string          `json:"detector"`
+	Severity   string          `json:"severity"`
+	Status     string          `json:"status"`
+	EpisodeID  string          `json:"episode_id"`
+	Confidence float64         `json:"-"`
+	Details    string          `json:"details"`
+	Metrics    json.RawMessage `json:"metrics,omitempty"`
+	Label      string          `json:"label,omitempty"`
+	Timestamp  time.Time       `json:"timestamp"`
+}
+
+func queryAnomalies(pg *db.PostgresDB, filter db.AnomalyFilter) ([]storedAnomaly, error) {
+	rows, err := pg.GetAnomalies(filter)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	anomalies := []storedAnomaly{}
+	for rows.Next() {
+		var a storedAnomaly
+		var snapshot []byte
+		if err := rows.Scan(&a.ID, &a.Symbol, &a.Type, &a.Detector, &a.Severity, &a.Status, &a.EpisodeID, &a.Confidence, &a.Details, &snapshot, &a.Label, &a.Timestamp); err != nil {
+			return nil, err
+		}
+		if snapshot != nil {
+			a.Metrics = snapshot
+		}
+		anomalies = append(anomalies, a)
+	}
+	return anomalies, rows.Err()
+}
 
-	log.Printf("StockTrader Pro Backend starting on port %s", port)
-	if err := http.ListenAndServe(":"+port, nil); err != nil {
-		log.Fatal(err)
+func nextOffset(filter db.AnomalyFilter, returned int) *int {
+	if returned < filter.Limit {
+		return nil
 	}
+	next := filter.Offset + returned
+	return &next
 }